@@ -0,0 +1,210 @@
+package artifact
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 支持的上传格式
+const (
+	FormatTarGz  = "tar.gz"
+	FormatZip    = "zip"
+	FormatBundle = "bundle"
+)
+
+// ErrTooLarge 解压后的总大小或条目数超过上限
+var ErrTooLarge = errors.New("解压后的内容超过上限")
+
+// Limits 解压的上限，避免压缩炸弹占满磁盘，0 表示不限制
+type Limits struct {
+	// MaxSize 解压后文件的总大小（字节）
+	MaxSize int64
+	// MaxEntries 条目总数，包括目录与被跳过的条目
+	MaxEntries int
+}
+
+// Detect 根据文件头识别上传文件的格式
+func Detect(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 16)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return FormatTarGz, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return FormatZip, nil
+	case bytes.HasPrefix(head, []byte("# v2 git bundle")), bytes.HasPrefix(head, []byte("# v3 git bundle")):
+		return FormatBundle, nil
+	}
+	return "", fmt.Errorf("无法识别的文件格式，只支持 tar.gz、zip 与 git bundle")
+}
+
+// Extract 将 tar.gz 或 zip 文件解压到 dest
+// 条目路径以 dest 为根清理，不会写到 dest 以外；符号链接等特殊文件会被跳过
+// 超过 limits 时中止解压并返回 ErrTooLarge，已解压的文件由调用方清理
+func Extract(file, format, dest string, limits Limits) error {
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	e := &extractor{dest: dest, limits: limits}
+	switch format {
+	case FormatTarGz:
+		return e.extractTarGz(file)
+	case FormatZip:
+		return e.extractZip(file)
+	}
+	return fmt.Errorf("不支持解压的格式: %s", format)
+}
+
+// extractor 记录一次解压已写入的大小与条目数
+type extractor struct {
+	dest    string
+	limits  Limits
+	size    int64
+	entries int
+}
+
+// countEntry 计入一个条目，超过条目数上限时返回错误
+func (e *extractor) countEntry() error {
+	e.entries++
+	if e.limits.MaxEntries > 0 && e.entries > e.limits.MaxEntries {
+		return fmt.Errorf("%w: 条目数超过 %d", ErrTooLarge, e.limits.MaxEntries)
+	}
+	return nil
+}
+
+// extractTarGz 解压 tar.gz 文件
+func (e *extractor) extractTarGz(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("读取 gzip 失败: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取 tar 失败: %w", err)
+		}
+		if err := e.countEntry(); err != nil {
+			return err
+		}
+		name := entryPath(e.dest, hdr.Name)
+		if name == "" {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := e.writeFile(name, tr, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		default:
+			log.Printf("跳过不支持的条目: %s", hdr.Name)
+		}
+	}
+}
+
+// extractZip 解压 zip 文件
+func (e *extractor) extractZip(file string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return fmt.Errorf("读取 zip 失败: %w", err)
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		if err := e.countEntry(); err != nil {
+			return err
+		}
+		name := entryPath(e.dest, zf.Name)
+		if name == "" {
+			continue
+		}
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := zf.Open()
+			if err != nil {
+				return err
+			}
+			err = e.writeFile(name, rc, mode)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			log.Printf("跳过不支持的条目: %s", zf.Name)
+		}
+	}
+	return nil
+}
+
+// entryPath 返回压缩包条目在 dest 中的路径，根目录条目返回空字符串
+func entryPath(dest, name string) string {
+	clean := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if clean == "/" {
+		return ""
+	}
+	return filepath.Join(dest, filepath.FromSlash(clean))
+}
+
+// writeFile 写入普通文件，保留可执行权限；按实际读出的内容计入总大小，不信任条目头中记录的大小
+func (e *extractor) writeFile(name string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	out, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if e.limits.MaxSize > 0 {
+		r = io.LimitReader(r, e.limits.MaxSize-e.size+1)
+	}
+	n, err := io.Copy(out, r)
+	e.size += n
+	if err == nil && e.limits.MaxSize > 0 && e.size > e.limits.MaxSize {
+		err = fmt.Errorf("%w: 总大小超过 %d MB", ErrTooLarge, e.limits.MaxSize>>20)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
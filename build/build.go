@@ -0,0 +1,120 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"git2Web/config"
+)
+
+// defaultTimeout 未配置超时时间时构建的最长执行时间
+const defaultTimeout = 10 * time.Minute
+
+// maxOutputSize 保留的构建输出上限，超出时只保留末尾部分
+const maxOutputSize = 16 * 1024
+
+// Run 在 dir 中依次执行站点的构建命令，任一命令失败即停止
+// 返回的构建记录包含合并后的标准输出与标准错误
+func Run(site *config.Site, dir, commit string) (*config.BuildInfo, error) {
+	start := time.Now()
+	info := &config.BuildInfo{Commit: commit, At: start}
+
+	timeout := defaultTimeout
+	if site.Build.TimeoutSec > 0 {
+		timeout = time.Duration(site.Build.TimeoutSec) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	env := append(buildEnv(site.Build.PassEnv),
+		"GIT2WEB_SITE="+site.Label(),
+		"GIT2WEB_COMMIT="+commit,
+	)
+	for k, v := range site.Build.Env {
+		env = append(env, k+"="+v)
+	}
+
+	var output bytes.Buffer
+	err := func() error {
+		for _, command := range site.Build.Commands {
+			log.Printf("[%s] 执行构建命令: %s", site.Label(), command)
+			fmt.Fprintf(&output, "$ %s\n", command)
+
+			cmd := shellCommand(ctx, command)
+			cmd.Dir = dir
+			cmd.Env = env
+			cmd.Stdout = &output
+			cmd.Stderr = &output
+			setProcessGroup(cmd)
+			// 超时后子进程可能仍占用输出管道，限制等待时间
+			cmd.WaitDelay = 5 * time.Second
+			if err := cmd.Run(); err != nil {
+				if ctx.Err() == context.DeadlineExceeded {
+					return fmt.Errorf("构建超时（%s）: %s", timeout, command)
+				}
+				return fmt.Errorf("构建命令失败: %s: %w", command, err)
+			}
+		}
+
+		// 确认构建产生了输出目录
+		root := site.GetServeRoot(dir)
+		if stat, err := os.Stat(root); err != nil || !stat.IsDir() {
+			return fmt.Errorf("构建输出目录不存在: %s", site.Build.OutputDir)
+		}
+		return nil
+	}()
+
+	info.Success = err == nil
+	info.Duration = time.Since(start).String()
+	info.Output = tail(output.String(), maxOutputSize)
+	if err != nil {
+		log.Printf("[%s] 构建失败，用时 %s: %v", site.Label(), info.Duration, err)
+		return info, err
+	}
+	log.Printf("[%s] 构建成功，用时 %s", site.Label(), info.Duration)
+	return info, nil
+}
+
+// baseEnv 传递给构建命令的基本环境变量，运行 shell 与常见工具需要
+var baseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_ALL", "LC_CTYPE", "TZ", "TMPDIR", "TERM",
+	// Windows
+	"SystemRoot", "SystemDrive", "windir", "ComSpec", "PATHEXT", "TEMP", "TMP",
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA", "ProgramData", "ProgramFiles", "ProgramFiles(x86)",
+}
+
+// buildEnv 返回构建命令继承的环境变量，只包含 baseEnv 与 passEnv 中列出的变量
+// 构建命令可能来自不受信任的提交，不能读取服务器的仓库凭据等其他环境变量
+func buildEnv(passEnv []string) []string {
+	var env []string
+	for _, names := range [][]string{baseEnv, passEnv} {
+		for _, name := range names {
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+	return env
+}
+
+// shellCommand 使用系统 shell 执行命令
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// tail 返回 s 末尾不超过 n 字节的部分
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return "...\n" + s[len(s)-n:]
+}
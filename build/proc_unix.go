@@ -0,0 +1,16 @@
+//go:build !windows
+
+package build
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让构建命令在独立的进程组中运行，超时时结束整个进程组
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package build
+
+import "os/exec"
+
+// setProcessGroup Windows 下沿用默认的超时处理，只结束 shell 进程
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"git2Web/config"
+)
+
+// runRollback 处理 rollback 子命令，请求正在运行的 Git2Web 实例执行回滚
+//
+//	./main rollback [-site <name>] [-commit <hash>] [-addr http://127.0.0.1:8081]
+func runRollback(args []string) int {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	site := fs.String("site", "", "回滚的站点名称，只有一个站点时可省略")
+	commit := fs.String("commit", "", "回滚到指定的本地提交，留空则回滚到上一个部署")
+	addr := fs.String("addr", "", "Webhook 服务地址，默认 http://127.0.0.1:<webhook_port>")
+	fs.Parse(args)
+
+	query := url.Values{}
+	if *site != "" {
+		query.Set("site", *site)
+	}
+	if *commit != "" {
+		query.Set("commit", *commit)
+	}
+	return postAdmin(*addr, "/rollback", query, nil, "回滚")
+}
+
+// runUpload 处理 upload 子命令，将 tar.gz、zip 或 git bundle 文件上传到正在运行的 Git2Web 实例并部署
+//
+//	./main upload -version <版本> -file <文件> [-site <name>] [-addr http://127.0.0.1:8081]
+func runUpload(args []string) int {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	site := fs.String("site", "", "部署的站点名称，只有一个站点时可省略")
+	version := fs.String("version", "", "部署的版本，记录在部署历史中")
+	file := fs.String("file", "", "上传的 tar.gz、zip 或 git bundle 文件")
+	addr := fs.String("addr", "", "Webhook 服务地址，默认 http://127.0.0.1:<webhook_port>")
+	fs.Parse(args)
+
+	if *version == "" || *file == "" {
+		fmt.Fprintln(os.Stderr, "请指定 -version 与 -file")
+		return 1
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开文件失败: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	query := url.Values{}
+	query.Set("version", *version)
+	if *site != "" {
+		query.Set("site", *site)
+	}
+	return postAdmin(*addr, "/upload", query, f, "上传部署")
+}
+
+// postAdmin 携带管理令牌向正在运行的实例发送 POST 请求并输出响应，返回进程退出码
+func postAdmin(addr, path string, query url.Values, body io.Reader, action string) int {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置时出错: %v\n", err)
+		return 1
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:" + cfg.WebhookPort
+	}
+
+	endpoint := strings.TrimSuffix(addr, "/") + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建请求失败: %v\n", err)
+		return 1
+	}
+	if token := cfg.GetAdminToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "请求%s失败: %v\n", action, err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	fmt.Println(strings.TrimSpace(string(respBody)))
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
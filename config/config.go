@@ -2,38 +2,282 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git2Web/schedule"
 )
 
 // AppVersion 应用版本
 const AppVersion = "1.3.0"
 
+// DefaultHistoryPath 部署历史的默认保存路径
+const DefaultHistoryPath = "./data/history.jsonl"
+
+// DefaultUploadMaxSizeMB 上传部署文件的默认大小上限
+const DefaultUploadMaxSizeMB = 512
+
+// DefaultUploadMaxExtractSizeMB 上传的压缩包解压后的默认总大小上限
+const DefaultUploadMaxExtractSizeMB = 4096
+
+// DefaultUploadMaxEntries 上传的压缩包默认的条目数上限
+const DefaultUploadMaxEntries = 100000
+
+// 仓库同步策略
+const (
+	// SyncStrategyPull 快进拉取，历史分叉时失败
+	SyncStrategyPull = "pull"
+	// SyncStrategyReset 获取后硬重置到远程引用并清理未跟踪文件
+	SyncStrategyReset = "reset"
+)
+
 // Config 应用配置
+// 未配置 sites 时，顶层的站点字段描述唯一的站点
 type Config struct {
+	Site
+	WebhookPort  string `json:"webhook_port"`
+	AdminToken   string `json:"admin_token"`
+	LogFilePath  string `json:"log_file_path"`
+	LogMaxSizeMB int    `json:"log_max_size_mb"`
+	HistoryPath  string `json:"history_path"`
+	// UploadMaxSizeMB 上传部署文件的大小上限，0 表示使用默认值
+	UploadMaxSizeMB int `json:"upload_max_size_mb"`
+	// UploadMaxExtractSizeMB 与 UploadMaxEntries 为上传的压缩包解压后的总大小与条目数上限，0 表示使用默认值
+	UploadMaxExtractSizeMB int    `json:"upload_max_extract_size_mb"`
+	UploadMaxEntries       int    `json:"upload_max_entries"`
+	Version                string `json:"version"`
+
+	// Sites 多站点配置，配置后顶层的站点字段不再生效
+	Sites []*Site `json:"sites,omitempty"`
+}
+
+// Site 站点配置，每个站点有独立的仓库、认证、分区与 Webhook 密钥
+type Site struct {
+	Name            string   `json:"name,omitempty"`
+	Hosts           []string `json:"hosts,omitempty"`
 	RepoURL         string   `json:"repo_url"`
+	Branch          string   `json:"branch"`
+	TagPattern      string   `json:"tag_pattern"`
+	PinnedCommit    string   `json:"pinned_commit"`
+	CloneDepth      int      `json:"clone_depth"`
+	SingleBranch    bool     `json:"single_branch"`
+	SubmoduleDepth  int      `json:"submodule_depth"`
+	SyncStrategy    string   `json:"sync_strategy"`
 	UpdateOnStart   bool     `json:"update_on_start"`
+	PollInterval    string   `json:"poll_interval"`
+	PollCron        string   `json:"poll_cron"`
 	TargetPathA     string   `json:"target_path_a"`
 	TargetPathB     string   `json:"target_path_b"`
 	ActivePartition string   `json:"active_partition"`
-	WebhookPort     string   `json:"webhook_port"`
 	WebhookSecret   string   `json:"webhook_secret"`
 	StaticPort      string   `json:"static_port"`
 	StaticPath      string   `json:"static_path"`
-	LogFilePath     string   `json:"log_file_path"`
-	LogMaxSizeMB    int      `json:"log_max_size_mb"`
+	CommitHeaders   bool     `json:"commit_headers"`
+	SparseCheckout  bool     `json:"sparse_checkout"`
 	RepoAuth        RepoAuth `json:"repo_auth"`
 	LfsEnabled      bool     `json:"lfs_enabled"`
-	Version         string   `json:"version"`
+	LfsURL          string   `json:"lfs_url"`
+	LfsConcurrency  int      `json:"lfs_concurrency"`
+	// LfsTimeoutSec 单个 LFS 请求（包括下载一个对象）的最长时间，0 表示使用默认值
+	LfsTimeoutSec int `json:"lfs_timeout_sec,omitempty"`
+
+	// Mounts 发布的仓库子目录及其 URL 前缀，为空时发布整个仓库
+	Mounts []Mount `json:"mounts,omitempty"`
+
+	// Serve 静态文件服务的行为，如单页应用回退与错误页面
+	Serve *ServeConfig `json:"serve,omitempty"`
+
+	// Build 构建步骤，在非激活分区中执行，成功后才切换分区
+	Build *BuildConfig `json:"build,omitempty"`
+
+	// Verify 切换分区前对新版本的检查，任一检查失败则不切换
+	Verify *VerifyConfig `json:"verify,omitempty"`
+
+	// Signature 只部署由受信任密钥签名的提交，未签名或签名不受信任的提交会被拒绝
+	Signature *SignatureConfig `json:"signature,omitempty"`
+
+	// Preview 分支预览，生产分支以外的分支推送后部署到独立目录
+	Preview *PreviewConfig `json:"preview,omitempty"`
+
+	// SubmoduleAuth 按主机名配置子模块的认证信息，未配置的主机沿用 repo_auth（仅限同主机）
+	SubmoduleAuth map[string]RepoAuth `json:"submodule_auth,omitempty"`
+
+	// Ref 直接部署的引用（如 refs/pull/1/head），优先于其他部署目标，仅用于预览，不保存到配置文件
+	Ref string `json:"-"`
+
+	// 以下为运行状态，由程序自动维护
+	Partitions   map[string]PartitionInfo `json:"partitions,omitempty"`
+	LastRollback *RollbackInfo            `json:"last_rollback,omitempty"`
+	LastBuild    *BuildInfo               `json:"last_build,omitempty"`
+	Previews     map[string]PreviewInfo   `json:"previews,omitempty"`
+}
+
+// PreviewConfig 分支与合并请求预览配置
+// 未配置 port 时预览在站点端口的 /_preview/<名称>/ 下提供，配置后在预览端口的 /<名称>/ 下提供
+type PreviewConfig struct {
+	Branches     []string `json:"branches,omitempty"`
+	PullRequests bool     `json:"pull_requests,omitempty"`
+	// AllowForks 为来自派生仓库的合并请求部署预览，构建命令会执行不受信任的代码
+	AllowForks bool   `json:"allow_forks,omitempty"`
+	Dir        string `json:"dir,omitempty"`
+	Port       string `json:"port,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+}
+
+// PreviewInfo 预览中部署的版本信息，合并请求的预览记录编号与标题
+type PreviewInfo struct {
+	Branch      string    `json:"branch"`
+	PullRequest int       `json:"pull_request,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Commit      string    `json:"commit"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BuildConfig 构建配置，命令通过 shell 在仓库根目录依次执行
+type BuildConfig struct {
+	Commands []string          `json:"commands"`
+	Env      map[string]string `json:"env,omitempty"`
+	// PassEnv 构建命令继承的服务器环境变量，除 PATH、HOME 等基本变量外默认不继承
+	PassEnv    []string `json:"pass_env,omitempty"`
+	TimeoutSec int      `json:"timeout_sec"`
+	OutputDir  string   `json:"output_dir"`
+}
+
+// VerifyConfig 切换前检查，文件路径相对于提供服务的根目录
+type VerifyConfig struct {
+	RequiredFiles []string `json:"required_files,omitempty"`
+	MinFiles      int      `json:"min_files,omitempty"`
+	NoLfsPointers bool     `json:"no_lfs_pointers,omitempty"`
+	Probes        []Probe  `json:"probes,omitempty"`
+}
+
+// Probe 通过临时监听访问新版本的 HTTP 检查，Status 为 0 时期望 200
+type Probe struct {
+	Path     string `json:"path"`
+	Status   int    `json:"status,omitempty"`
+	Contains string `json:"contains,omitempty"`
+}
+
+// SignatureConfig 受信任的签名密钥
+// GPG 使用 ASCII 格式导出的公钥文件，SSH 使用 git 的 allowed_signers 或 authorized_keys 格式的文件
+type SignatureConfig struct {
+	GPGKeyringPath        string `json:"gpg_keyring_path,omitempty"`
+	SSHAllowedSignersPath string `json:"ssh_allowed_signers_path,omitempty"`
+}
+
+// BuildInfo 最近一次构建的记录
+type BuildInfo struct {
+	Commit   string    `json:"commit"`
+	Success  bool      `json:"success"`
+	Output   string    `json:"output"`
+	Duration string    `json:"duration"`
+	At       time.Time `json:"at"`
+}
+
+// ServeConfig 静态文件服务配置，文件路径相对于提供服务的目录（配置挂载时为各挂载目录）
+type ServeConfig struct {
+	// SPA 单页应用模式，不存在且没有扩展名的路径返回 Fallback 页面，状态码为 200
+	SPA      bool   `json:"spa,omitempty"`
+	Fallback string `json:"fallback,omitempty"`
+	// ErrorPages 各状态码的错误页面，未配置 404 时使用存在的 404.html
+	ErrorPages map[int]string `json:"error_pages,omitempty"`
+	// CleanURLs 简洁 URL，/about 在没有同名文件或目录时返回 about.html，/about.html 重定向到 /about
+	CleanURLs bool `json:"clean_urls,omitempty"`
+	// IndexFiles 目录的索引文件，按顺序查找，为空时为 index.html
+	IndexFiles []string `json:"index_files,omitempty"`
+	// Listing 没有索引文件的目录的列出方式，见 Listing* 常量，为空时为 raw
+	Listing string `json:"listing,omitempty"`
+	// ListingStatus Listing 为 off 时返回的状态码，403 或 404，为空时为 404
+	ListingStatus int `json:"listing_status,omitempty"`
+	// Compress 按 Accept-Encoding 返回压缩的内容，优先使用 .br/.gz 文件，没有时对文本类文件即时压缩
+	Compress bool `json:"compress,omitempty"`
+	// CacheRules 按路径设置 Cache-Control，使用第一条匹配的规则
+	CacheRules []CacheRule `json:"cache_rules,omitempty"`
+}
+
+// CacheRule 路径匹配的缓存规则，只作用于返回的文件
+// Path 为站点中文件的 URL 路径模式，* 匹配路径中的一级，** 匹配任意多级，如 /assets/**；不含 / 的模式匹配文件名，如 *.html
+type CacheRule struct {
+	Path         string `json:"path"`
+	CacheControl string `json:"cache_control"`
+}
+
+// 目录列表方式
+const (
+	// ListingRaw 简单的文件名列表
+	ListingRaw = "raw"
+	// ListingHTML 带文件大小、修改时间与路径导航的页面
+	ListingHTML = "html"
+	// ListingOff 不列出目录
+	ListingOff = "off"
+)
+
+// GetListingStatus 返回不列出目录时的状态码
+func (c *ServeConfig) GetListingStatus() int {
+	if c.ListingStatus == http.StatusForbidden {
+		return http.StatusForbidden
+	}
+	return http.StatusNotFound
+}
+
+// GetIndexFiles 返回目录的索引文件列表
+func (c *ServeConfig) GetIndexFiles() []string {
+	if len(c.IndexFiles) == 0 {
+		return []string{"index.html"}
+	}
+	return c.IndexFiles
+}
+
+// DefaultFallback 单页应用模式默认的回退页面
+const DefaultFallback = "index.html"
+
+// Mount 将仓库中的子目录挂载到 URL 前缀，例如 docs/ 挂载到 /
+type Mount struct {
+	Dir    string `json:"dir"`
+	Prefix string `json:"prefix"`
+}
+
+// PartitionInfo 分区中部署的版本信息，通过上传部署时 Version 为上传时指定的版本
+type PartitionInfo struct {
+	Ref            string    `json:"ref"`
+	Commit         string    `json:"commit"`
+	Version        string    `json:"version,omitempty"`
+	PreviousCommit string    `json:"previous_commit,omitempty"`
+	DeployedAt     time.Time `json:"deployed_at"`
+}
+
+// RollbackInfo 最近一次回滚的记录
+type RollbackInfo struct {
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	FromPartition string    `json:"from_partition"`
+	ToPartition   string    `json:"to_partition"`
+	At            time.Time `json:"at"`
 }
 
 // RepoAuth 仓库认证信息
+// HTTPS 地址使用 Email/Password，SSH 地址（如 git@host:org/repo.git）使用私钥
+// 密码可以来自文件、环境变量或凭据助手，在使用时读取，不会写入配置文件
 type RepoAuth struct {
-	Enabled  bool   `json:"enabled"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Enabled          bool   `json:"enabled"`
+	Email            string `json:"email"`
+	Password         string `json:"password,omitempty"`
+	PasswordFile     string `json:"password_file,omitempty"`
+	PasswordEnv      string `json:"password_env,omitempty"`
+	CredentialHelper string `json:"credential_helper,omitempty"`
+	SSHKeyPath       string `json:"ssh_key_path"`
+	SSHKeyEnv        string `json:"ssh_key_env"`
+	SSHKeyPassphrase string `json:"ssh_key_passphrase"`
+	KnownHostsPath   string `json:"known_hosts_path"`
 }
 
 // getEnv 获取环境变量，若不存在则返回默认值
@@ -85,24 +329,54 @@ func LoadConfig(filename string) (*Config, error) {
 	// 如果配置文件不存在，则创建默认配置（优先读取环境变量）
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		defaultConfig := Config{
-			RepoURL:         getEnv("REPO_URL", "https://github.com/yourusername/yourrepo.git"),
-			UpdateOnStart:   getEnvBool("UPDATE_ON_START", true),
-			TargetPathA:     getEnv("TARGET_PATH_A", "./data/repo_a"),
-			TargetPathB:     getEnv("TARGET_PATH_B", "./data/repo_b"),
-			ActivePartition: getEnv("ACTIVE_PARTITION", "a"),
-			WebhookPort:     getEnv("WEBHOOK_PORT", "8081"),
-			WebhookSecret:   getEnv("WEBHOOK_SECRET", ""),
-			StaticPort:      getEnv("STATIC_PORT", "8080"),
-			StaticPath:      getEnv("STATIC_PATH", "./data/repo"),
-			LogFilePath:     getEnv("LOG_FILE_PATH", "./logs/server.log"),
-			LogMaxSizeMB:    getEnvInt("LOG_MAX_SIZE_MB", 5),
-			RepoAuth: RepoAuth{
-				Enabled:  getEnvBool("REPO_AUTH_ENABLED", false),
-				Email:    getEnv("REPO_AUTH_EMAIL", "example@example.com"),
-				Password: getEnv("REPO_AUTH_PASSWORD", "1234"),
+			Site: Site{
+				RepoURL:         getEnv("REPO_URL", "https://github.com/yourusername/yourrepo.git"),
+				Branch:          getEnv("BRANCH", ""),
+				TagPattern:      getEnv("TAG_PATTERN", ""),
+				PinnedCommit:    getEnv("PINNED_COMMIT", ""),
+				CloneDepth:      getEnvInt("CLONE_DEPTH", 0),
+				SingleBranch:    getEnvBool("SINGLE_BRANCH", false),
+				SubmoduleDepth:  getEnvInt("SUBMODULE_DEPTH", 0),
+				SyncStrategy:    getEnv("SYNC_STRATEGY", SyncStrategyPull),
+				UpdateOnStart:   getEnvBool("UPDATE_ON_START", true),
+				PollInterval:    getEnv("POLL_INTERVAL", ""),
+				PollCron:        getEnv("POLL_CRON", ""),
+				TargetPathA:     getEnv("TARGET_PATH_A", "./data/repo_a"),
+				TargetPathB:     getEnv("TARGET_PATH_B", "./data/repo_b"),
+				ActivePartition: getEnv("ACTIVE_PARTITION", "a"),
+				WebhookSecret:   getEnv("WEBHOOK_SECRET", ""),
+				StaticPort:      getEnv("STATIC_PORT", "8080"),
+				StaticPath:      getEnv("STATIC_PATH", "./data/repo"),
+				CommitHeaders:   getEnvBool("COMMIT_HEADERS", false),
+				SparseCheckout:  getEnvBool("SPARSE_CHECKOUT", false),
+				RepoAuth: RepoAuth{
+					Enabled:          getEnvBool("REPO_AUTH_ENABLED", false),
+					Email:            getEnv("REPO_AUTH_EMAIL", "example@example.com"),
+					PasswordFile:     getEnv("REPO_AUTH_PASSWORD_FILE", ""),
+					PasswordEnv:      getEnv("REPO_AUTH_PASSWORD_ENV", "REPO_AUTH_PASSWORD"),
+					CredentialHelper: getEnv("REPO_AUTH_CREDENTIAL_HELPER", ""),
+					SSHKeyPath:       getEnv("REPO_AUTH_SSH_KEY_PATH", ""),
+					SSHKeyEnv:        getEnv("REPO_AUTH_SSH_KEY_ENV", "REPO_AUTH_SSH_KEY"),
+					SSHKeyPassphrase: getEnv("REPO_AUTH_SSH_KEY_PASSPHRASE", ""),
+					KnownHostsPath:   getEnv("REPO_AUTH_KNOWN_HOSTS", ""),
+				},
+				LfsEnabled:     getEnvBool("LFS_ENABLED", false),
+				LfsURL:         getEnv("LFS_URL", ""),
+				LfsConcurrency: getEnvInt("LFS_CONCURRENCY", 4),
+				LfsTimeoutSec:  getEnvInt("LFS_TIMEOUT_SEC", 0),
 			},
-			LfsEnabled: getEnvBool("LFS_ENABLED", false),
-			Version:    AppVersion,
+			WebhookPort:            getEnv("WEBHOOK_PORT", "8081"),
+			AdminToken:             getEnv("ADMIN_TOKEN", ""),
+			LogFilePath:            getEnv("LOG_FILE_PATH", "./logs/server.log"),
+			LogMaxSizeMB:           getEnvInt("LOG_MAX_SIZE_MB", 5),
+			HistoryPath:            getEnv("HISTORY_PATH", DefaultHistoryPath),
+			UploadMaxSizeMB:        getEnvInt("UPLOAD_MAX_SIZE_MB", DefaultUploadMaxSizeMB),
+			UploadMaxExtractSizeMB: getEnvInt("UPLOAD_MAX_EXTRACT_SIZE_MB", DefaultUploadMaxExtractSizeMB),
+			UploadMaxEntries:       getEnvInt("UPLOAD_MAX_ENTRIES", DefaultUploadMaxEntries),
+			Version:                AppVersion,
+		}
+		if dir := getEnv("PUBLISH_DIR", ""); dir != "" {
+			defaultConfig.Mounts = []Mount{{Dir: dir, Prefix: "/"}}
 		}
 
 		configData, err := json.MarshalIndent(defaultConfig, "", "  ")
@@ -125,6 +399,9 @@ func LoadConfig(filename string) (*Config, error) {
 	if err := json.Unmarshal(file, &config); err != nil {
 		return nil, err
 	}
+	if err := config.loadSites(file); err != nil {
+		return nil, err
+	}
 
 	// 确保版本信息是最新的
 	config.Version = AppVersion
@@ -132,13 +409,113 @@ func LoadConfig(filename string) (*Config, error) {
 	return &config, nil
 }
 
+// loadSites 在站点默认值的基础上解析 sites 列表，并检查站点名称、端口与轮询配置
+func (c *Config) loadSites(data []byte) error {
+	var raw struct {
+		Sites []json.RawMessage `json:"sites"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	c.Sites = nil
+	names := make(map[string]bool)
+	for i, msg := range raw.Sites {
+		site := &Site{
+			SyncStrategy:    SyncStrategyPull,
+			UpdateOnStart:   true,
+			ActivePartition: "a",
+			StaticPort:      c.StaticPort,
+			LfsConcurrency:  4,
+		}
+		if err := json.Unmarshal(msg, site); err != nil {
+			return fmt.Errorf("解析第 %d 个站点配置失败: %w", i+1, err)
+		}
+		if !validSiteName.MatchString(site.Name) {
+			return fmt.Errorf("第 %d 个站点的名称 %q 无效，只能包含字母、数字、- 和 _", i+1, site.Name)
+		}
+		if names[site.Name] {
+			return fmt.Errorf("站点名称重复: %s", site.Name)
+		}
+		names[site.Name] = true
+		if site.TargetPathA == "" {
+			site.TargetPathA = filepath.Join("./data", site.Name, "repo_a")
+		}
+		if site.TargetPathB == "" {
+			site.TargetPathB = filepath.Join("./data", site.Name, "repo_b")
+		}
+		c.Sites = append(c.Sites, site)
+	}
+	if err := checkSitePorts(c.Sites); err != nil {
+		return err
+	}
+	// 轮询配置在加载时检查，避免克隆完成后才因无效的 cron 表达式退出
+	for _, site := range c.AllSites() {
+		if _, err := schedule.Parse(site.PollInterval, site.PollCron); err != nil {
+			return fmt.Errorf("站点 %s 的轮询配置无效: %w", site.Label(), err)
+		}
+	}
+	// 多站点时顶层的 webhook_secret 不使用，各站点的密钥也不能作为管理令牌
+	if len(c.Sites) > 0 && c.AdminToken == "" {
+		return fmt.Errorf("配置了 sites 时必须设置 admin_token")
+	}
+	return nil
+}
+
+// checkSitePorts 检查共用端口的站点都能被访问到: 每个端口最多一个站点不配置 hosts，同一端口上的域名不能重复
+func checkSitePorts(sites []*Site) error {
+	fallbacks := make(map[string]string)
+	hosts := make(map[string]string)
+	for _, site := range sites {
+		if len(site.Hosts) == 0 {
+			if other, ok := fallbacks[site.StaticPort]; ok {
+				return fmt.Errorf("站点 %s 与 %s 共用端口 %s 且都未配置 hosts，%s 无法访问", other, site.Name, site.StaticPort, site.Name)
+			}
+			fallbacks[site.StaticPort] = site.Name
+		}
+		for _, host := range site.Hosts {
+			key := site.StaticPort + "/" + strings.ToLower(host)
+			if other, ok := hosts[key]; ok && other != site.Name {
+				return fmt.Errorf("站点 %s 与 %s 在端口 %s 上配置了相同的域名 %s", other, site.Name, site.StaticPort, host)
+			}
+			hosts[key] = site.Name
+		}
+	}
+	return nil
+}
+
+// validSiteName 站点名称会出现在 URL 与目录中，只允许安全字符
+var validSiteName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// AllSites 返回所有站点，未配置 sites 时返回顶层的唯一站点
+func (c *Config) AllSites() []*Site {
+	if len(c.Sites) > 0 {
+		return c.Sites
+	}
+	return []*Site{&c.Site}
+}
+
+// FindSite 按名称查找站点，名称为空且只有一个站点时返回该站点
+func (c *Config) FindSite(name string) *Site {
+	sites := c.AllSites()
+	if name == "" && len(sites) == 1 {
+		return sites[0]
+	}
+	for _, site := range sites {
+		if site.Name == name && name != "" {
+			return site
+		}
+	}
+	return nil
+}
+
 // 确保目录存在
 func ensureDirExists(path string) error {
 	return os.MkdirAll(path, 0755)
 }
 
 // GetActiveTargetPath 获取当前活动分区的路径
-func (c *Config) GetActiveTargetPath() string {
+func (c *Site) GetActiveTargetPath() string {
 	if c.ActivePartition == "b" {
 		return c.TargetPathB
 	}
@@ -146,15 +523,214 @@ func (c *Config) GetActiveTargetPath() string {
 }
 
 // GetInactiveTargetPath 获取非活动分区的路径
-func (c *Config) GetInactiveTargetPath() string {
+func (c *Site) GetInactiveTargetPath() string {
 	if c.ActivePartition == "b" {
 		return c.TargetPathA
 	}
 	return c.TargetPathB
 }
 
+// GetInactivePartition 获取非活动分区的名称
+func (c *Site) GetInactivePartition() string {
+	if c.ActivePartition == "b" {
+		return "a"
+	}
+	return "b"
+}
+
+// DescribeTargetRef 返回配置中指定的部署目标描述
+// 优先级: 引用 > 固定提交 > 标签模式 > 分支 > 远程默认分支
+func (c *Site) DescribeTargetRef() string {
+	switch {
+	case c.Ref != "":
+		return "ref:" + c.Ref
+	case c.PinnedCommit != "":
+		return "commit:" + c.PinnedCommit
+	case c.TagPattern != "":
+		return "tag:" + c.TagPattern
+	case c.Branch != "":
+		return "branch:" + c.Branch
+	}
+	return "default"
+}
+
+// GetAdminToken 获取管理接口令牌
+// 不沿用 Webhook 密钥：该密钥同时保存在 Git 托管平台的 Webhook 设置中，能看到它的人不一定有权回滚或替换站点
+func (c *Config) GetAdminToken() string {
+	return c.AdminToken
+}
+
+// RecordDeployment 记录分区当前部署的引用与提交
+func (c *Site) RecordDeployment(partition, ref, commit string) {
+	c.recordPartition(partition, PartitionInfo{Ref: ref, Commit: commit})
+}
+
+// RecordUpload 记录通过上传部署到分区的版本，上传的构建产物没有引用与提交
+func (c *Site) RecordUpload(partition, version, ref, commit string) {
+	c.recordPartition(partition, PartitionInfo{Ref: ref, Commit: commit, Version: version})
+}
+
+// recordPartition 更新分区记录，提交未变化时保留上传的版本
+// 分区记录按写时复制更新，保存配置与读取状态时不会与之冲突
+func (c *Site) recordPartition(partition string, info PartitionInfo) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	partitions := make(map[string]PartitionInfo, len(c.Partitions)+1)
+	for k, v := range c.Partitions {
+		partitions[k] = v
+	}
+	prev := c.Partitions[partition]
+	info.PreviousCommit = prev.PreviousCommit
+	info.DeployedAt = time.Now()
+	if prev.Commit != "" && prev.Commit != info.Commit {
+		info.PreviousCommit = prev.Commit
+	}
+	if info.Version == "" && info.Commit != "" && info.Commit == prev.Commit {
+		info.Version = prev.Version
+	}
+	partitions[partition] = info
+	c.Partitions = partitions
+}
+
+// SiteState 站点运行状态的快照
+type SiteState struct {
+	ActivePartition string
+	Partitions      map[string]PartitionInfo
+	LastRollback    *RollbackInfo
+	LastBuild       *BuildInfo
+	Previews        map[string]PreviewInfo
+}
+
+// State 返回站点运行状态的副本，不持有站点锁的读取方（如健康检查）在部署、回滚进行时也可以安全使用
+func (c *Site) State() SiteState {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	state := SiteState{
+		ActivePartition: c.ActivePartition,
+		Partitions:      make(map[string]PartitionInfo, len(c.Partitions)),
+		Previews:        make(map[string]PreviewInfo, len(c.Previews)),
+	}
+	for k, v := range c.Partitions {
+		state.Partitions[k] = v
+	}
+	for k, v := range c.Previews {
+		state.Previews[k] = v
+	}
+	if c.LastRollback != nil {
+		rollback := *c.LastRollback
+		state.LastRollback = &rollback
+	}
+	if c.LastBuild != nil {
+		build := *c.LastBuild
+		state.LastBuild = &build
+	}
+	return state
+}
+
+// RecordRollback 记录最近一次回滚
+func (c *Site) RecordRollback(info *RollbackInfo) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	c.LastRollback = info
+}
+
+// Label 返回用于日志的站点名称
+func (c *Site) Label() string {
+	if c.Name == "" {
+		return "default"
+	}
+	return c.Name
+}
+
+// HasBuild 是否配置了构建步骤
+func (c *Site) HasBuild() bool {
+	return c.Build != nil && len(c.Build.Commands) > 0
+}
+
+// UsePartitions 是否使用 AB 分区更新，启用 LFS、构建或切换前检查时在非激活分区中准备新版本；
+// 未配置仓库地址、只通过上传部署的站点也使用 AB 分区
+func (c *Site) UsePartitions() bool {
+	return c.LfsEnabled || c.HasBuild() || c.Verify != nil || c.UploadOnly()
+}
+
+// UploadOnly 是否为未配置仓库地址、只通过上传部署的站点
+func (c *Site) UploadOnly() bool {
+	return c.RepoURL == ""
+}
+
+// GetUploadMaxSize 返回上传部署文件的大小上限（字节）
+func (c *Config) GetUploadMaxSize() int64 {
+	mb := c.UploadMaxSizeMB
+	if mb <= 0 {
+		mb = DefaultUploadMaxSizeMB
+	}
+	return int64(mb) << 20
+}
+
+// GetUploadExtractLimits 返回上传的压缩包解压后的总大小（字节）与条目数上限
+func (c *Config) GetUploadExtractLimits() (int64, int) {
+	mb := c.UploadMaxExtractSizeMB
+	if mb <= 0 {
+		mb = DefaultUploadMaxExtractSizeMB
+	}
+	entries := c.UploadMaxEntries
+	if entries <= 0 {
+		entries = DefaultUploadMaxEntries
+	}
+	return int64(mb) << 20, entries
+}
+
+// GetServeRoot 返回分区中提供服务的根目录，配置了构建输出目录时为该目录
+func (c *Site) GetServeRoot(partitionPath string) string {
+	if c.Build == nil || c.Build.OutputDir == "" {
+		return partitionPath
+	}
+	return filepath.Join(partitionPath, filepath.FromSlash(path.Clean("/"+c.Build.OutputDir)))
+}
+
+// RecordBuild 记录最近一次构建
+func (c *Site) RecordBuild(info *BuildInfo) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	c.LastBuild = info
+}
+
+// UseResetSync 是否使用获取后硬重置的同步策略
+func (c *Site) UseResetSync() bool {
+	return c.SyncStrategy == SyncStrategyReset
+}
+
+// SparseCheckoutDirs 返回稀疏检出的目录列表，未启用或发布整个仓库时返回 nil
+// 配置了构建时挂载的是构建输出，构建需要完整的源码，不使用稀疏检出
+func (c *Site) SparseCheckoutDirs() []string {
+	if !c.SparseCheckout || c.HasBuild() {
+		return nil
+	}
+	var dirs []string
+	for _, m := range c.Mounts {
+		dir := path.Clean(strings.Trim(m.Dir, "/"))
+		if dir == "." {
+			return nil
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// GetPartitionPath 获取指定分区的路径
+func (c *Site) GetPartitionPath(partition string) string {
+	if partition == "b" {
+		return c.TargetPathB
+	}
+	return c.TargetPathA
+}
+
 // SwitchActivePartition 切换活动分区
-func (c *Config) SwitchActivePartition() {
+func (c *Site) SwitchActivePartition() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
 	if c.ActivePartition == "a" {
 		c.ActivePartition = "b"
 	} else {
@@ -162,8 +738,101 @@ func (c *Config) SwitchActivePartition() {
 	}
 }
 
+// PreviewDir 返回预览检出的根目录，未配置时位于分区目录旁的 previews 目录
+func (c *Site) PreviewDir() string {
+	if c.Preview != nil && c.Preview.Dir != "" {
+		return c.Preview.Dir
+	}
+	return filepath.Join(filepath.Dir(c.TargetPathA), "previews")
+}
+
+// PreviewBranchMatches 判断分支是否需要部署预览
+// 未配置 branches 时匹配所有分支；启用合并请求预览后只匹配 branches 中的分支
+func (c *Site) PreviewBranchMatches(branch string) bool {
+	if c.Preview == nil {
+		return false
+	}
+	if len(c.Preview.Branches) == 0 {
+		return !c.Preview.PullRequests
+	}
+	for _, pattern := range c.Preview.Branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ForBranch 返回部署指定分支的站点配置副本，用于预览
+func (c *Site) ForBranch(branch string) *Site {
+	s := *c
+	s.Branch = branch
+	s.TagPattern = ""
+	s.PinnedCommit = ""
+	return &s
+}
+
+// ForRef 返回部署指定引用的站点配置副本，用于合并请求预览
+func (c *Site) ForRef(ref string) *Site {
+	s := c.ForBranch("")
+	s.Ref = ref
+	return s
+}
+
+// RecordPreview 记录预览部署的版本，按写时复制更新
+func (c *Site) RecordPreview(name string, info PreviewInfo) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	previews := make(map[string]PreviewInfo, len(c.Previews)+1)
+	for k, v := range c.Previews {
+		previews[k] = v
+	}
+	previews[name] = info
+	c.Previews = previews
+}
+
+// GetPreview 返回预览记录
+func (c *Site) GetPreview(name string) (PreviewInfo, bool) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	info, ok := c.Previews[name]
+	return info, ok
+}
+
+// GetPreviews 返回所有预览记录的副本，遍历时不会与预览的部署、删除冲突
+func (c *Site) GetPreviews() map[string]PreviewInfo {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+	previews := make(map[string]PreviewInfo, len(c.Previews))
+	for k, v := range c.Previews {
+		previews[k] = v
+	}
+	return previews
+}
+
+// RemovePreview 删除预览记录
+func (c *Site) RemovePreview(name string) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	previews := make(map[string]PreviewInfo, len(c.Previews))
+	for k, v := range c.Previews {
+		if k != name {
+			previews[k] = v
+		}
+	}
+	c.Previews = previews
+}
+
+// stateMutex 保护各站点运行状态的修改与配置文件的写入
+var stateMutex sync.Mutex
+
 // SaveConfig 保存配置到文件
 func (c *Config) SaveConfig(configPath string) error {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
@@ -0,0 +1,179 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 更新的触发来源
+const (
+	TriggerStartup  = "startup"
+	TriggerWebhook  = "webhook"
+	TriggerPoll     = "poll"
+	TriggerRollback = "rollback"
+	TriggerUpload   = "upload"
+)
+
+// 更新结果
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+// Record 一次更新尝试的记录
+type Record struct {
+	ID         int64     `json:"id"`
+	Site       string    `json:"site"`
+	Trigger    string    `json:"trigger"`
+	Commit     string    `json:"commit,omitempty"`
+	Ref        string    `json:"ref,omitempty"`
+	Version    string    `json:"version,omitempty"`
+	Author     string    `json:"author,omitempty"`
+	Message    string    `json:"message,omitempty"`
+	Partition  string    `json:"partition,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Query 查询条件，Page 从 1 开始，记录按时间倒序排列
+type Query struct {
+	Site    string
+	Page    int
+	PerPage int
+}
+
+// Store 以 JSON Lines 格式追加保存记录的本地存储
+type Store struct {
+	path   string
+	mu     sync.Mutex
+	nextID int64
+}
+
+// Open 打开或创建存储文件
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建部署历史目录失败: %w", err)
+	}
+	s := &Store{path: path, nextID: 1}
+	records, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+	if n := len(records); n > 0 {
+		s.nextID = records[n-1].ID + 1
+	}
+	return s, nil
+}
+
+// Append 追加一条记录并分配 ID
+func (s *Store) Append(r *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = s.nextID
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开部署历史失败: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("写入部署历史失败: %w", err)
+	}
+	s.nextID++
+	return f.Close()
+}
+
+// List 按条件分页查询记录，返回当前页的记录与符合条件的总数
+func (s *Store) List(q Query) ([]Record, int, error) {
+	records, err := s.load(q.Site)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(records)
+	start := (q.Page - 1) * q.PerPage
+	if start >= total {
+		return []Record{}, total, nil
+	}
+	end := start + q.PerPage
+	if end > total {
+		end = total
+	}
+	// 倒序: 最新的记录在前
+	page := make([]Record, 0, end-start)
+	for i := total - 1 - start; i >= total-end; i-- {
+		page = append(page, records[i])
+	}
+	return page, total, nil
+}
+
+// LiveAt 返回站点在 t 时刻正在提供服务的部署，即 t 之前最后一次成功的更新
+func (s *Store) LiveAt(site string, t time.Time) (*Record, error) {
+	records, err := s.load(site)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		r := records[i]
+		if r.Result == ResultSuccess && !r.FinishedAt.After(t) {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// load 读取站点的全部记录，site 为空时返回所有站点的记录
+func (s *Store) load(site string) ([]Record, error) {
+	s.mu.Lock()
+	records, err := s.readAll()
+	s.mu.Unlock()
+	if err != nil || site == "" {
+		return records, err
+	}
+
+	filtered := records[:0]
+	for _, r := range records {
+		if r.Site == site {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered, nil
+}
+
+// readAll 读取文件中的全部记录，跳过无法解析的行（如写入中断留下的残缺行）
+func (s *Store) readAll() ([]Record, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取部署历史失败: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) == nil {
+			records = append(records, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取部署历史失败: %w", err)
+	}
+	return records, nil
+}
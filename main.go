@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"git2Web/config"
+	"git2Web/history"
 	"git2Web/logger"
 	"git2Web/repo"
 	"git2Web/server"
@@ -16,6 +17,13 @@ import (
 const configPath = "etc/config.json"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rollback" {
+		os.Exit(runRollback(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "upload" {
+		os.Exit(runUpload(os.Args[2:]))
+	}
+
 	server.StartTime = time.Now()
 
 	logo := `
@@ -46,56 +54,111 @@ func main() {
 	}
 	log.Println("日志目录：", cfg.LogFilePath)
 
-	log.Println("同步自：", cfg.RepoURL)
-	if cfg.RepoAuth.Enabled {
+	if err := server.InitHistory(cfg.HistoryPath); err != nil {
+		log.Fatalf("打开部署历史时出错: %v", err)
+	}
+
+	if cfg.GetAdminToken() == "" {
+		log.Println("警告: 未配置admin_token，回滚与上传部署接口已禁用，历史查询接口不验证令牌")
+	}
+
+	// 多站点时单个站点克隆失败不影响其他站点启动，可在修复后通过 Webhook 重新克隆
+	sites := cfg.AllSites()
+	for _, site := range sites {
+		if err := prepareSite(cfg, site); err != nil {
+			if len(sites) == 1 {
+				log.Fatalf("克隆仓库时出错: %v", err)
+			}
+			log.Printf("[%s] 克隆仓库时出错: %v，该站点暂不提供服务", site.Label(), err)
+		}
+	}
+
+	for _, site := range sites {
+		if err := server.StartPoller(cfg, site, configPath); err != nil {
+			log.Fatalf("[%s] 启动定时轮询时出错: %v", site.Label(), err)
+		}
+		if err := server.StartPreviewCleanup(cfg, site, configPath); err != nil {
+			log.Fatalf("[%s] 启动预览清理时出错: %v", site.Label(), err)
+		}
+	}
+
+	log.Printf("Git2Web 成功启动! 启动用时: %v", time.Since(server.StartTime))
+
+	go server.ServeStaticFiles(cfg)
+	go server.ServeWebhook(cfg, configPath)
+	select {}
+}
+
+// prepareSite 输出站点信息，并在启动时克隆或更新站点仓库
+func prepareSite(cfg *config.Config, site *config.Site) error {
+	log.Printf("---------- 站点: %s ----------", site.Label())
+	if site.UploadOnly() {
+		log.Println("未配置 repo_url，站点只通过上传部署，当前活动分区:", site.GetActiveTargetPath())
+		return nil
+	}
+	log.Println("同步自：", site.RepoURL)
+	if site.RepoAuth.Enabled {
 		log.Println("已启用身份验证")
+		if site.RepoAuth.Password != "" {
+			log.Println("警告: 密码以明文保存在配置文件中，建议改用 password_file、password_env 或 credential_helper")
+		}
 	} else {
 		log.Println("未启用身份验证")
 	}
 
-	if cfg.LfsEnabled {
+	if site.LfsEnabled {
 		log.Println("已启用Git LFS")
-		log.Println("使用 AB 分区策略: 活动分区", cfg.ActivePartition)
 	} else {
 		log.Println("未启用Git LFS")
 	}
+	if site.HasBuild() {
+		log.Println("已启用构建步骤，输出目录:", site.Build.OutputDir)
+	}
+	if site.UsePartitions() {
+		log.Println("使用 AB 分区策略: 活动分区", site.ActivePartition)
+	}
 
-	if cfg.WebhookSecret != "" {
+	if site.WebhookSecret != "" {
 		log.Println("已启用Webhook安全验证")
 	} else {
 		log.Println("警告: 未启用Webhook安全验证，建议在配置中设置webhook_secret")
 	}
 
 	// 获取活动分区路径
-	activePath := cfg.GetActiveTargetPath()
+	activePath := site.GetActiveTargetPath()
 	log.Printf("当前活动分区: %s", activePath)
 
+	start := time.Now()
 	if _, err := os.Stat(activePath); os.IsNotExist(err) {
 		log.Println("未找到仓库，正在克隆...")
-		if err := repo.CloneRepoToPath(cfg, activePath); err != nil {
-			log.Fatalf("克隆仓库时出错: %v", err)
+		err := repo.CloneRepoToPath(site, activePath)
+		if err == nil {
+			err = server.BuildPartition(cfg, site, activePath, configPath)
+		}
+		if err != nil {
+			server.RecordHistory(site, history.TriggerStartup, start, "", err)
+			return err
 		}
+		server.RecordHistory(site, history.TriggerStartup, start, site.ActivePartition, nil)
 	} else {
 		log.Println("发现现有仓库")
-		if cfg.UpdateOnStart {
+		if site.UpdateOnStart && !site.UsePartitions() {
 			log.Println("检查仓库更新...")
-			if err := repo.PullRepo(cfg); err != nil {
+			partition := site.ActivePartition
+			err := repo.PullRepo(site)
+			if err != nil {
 				log.Printf("更新仓库时出错: %v，将尝试重新克隆", err)
-				// 如果更新失败，尝试删除并重新克隆
-				if err := os.RemoveAll(activePath); err != nil {
-					log.Fatalf("删除现有仓库失败: %v", err)
-				}
-				if err := repo.CloneRepoToPath(cfg, activePath); err != nil {
-					log.Fatalf("重新克隆仓库时出错: %v", err)
+				// 克隆到临时目录后再替换，克隆失败时继续使用现有仓库
+				if err = repo.RecloneRepo(site, activePath); err != nil {
+					log.Printf("重新克隆仓库时出错: %v，继续使用现有仓库", err)
+					partition = ""
 				}
 			}
+			server.RecordHistory(site, history.TriggerStartup, start, partition, err)
 		}
 	}
 
-	log.Printf("Git2Web 成功启动! 启动用时: %v", time.Since(server.StartTime))
-	log.Printf("静态文件服务: http://IP:%s (从 %s 提供服务)", cfg.StaticPort, activePath)
-
-	go server.ServeStaticFiles(activePath, cfg.StaticPort)
-	go server.ServeWebhook(cfg, configPath)
-	select {}
+	server.RecordDeployment(cfg, site, configPath)
+	log.Printf("静态文件服务: http://IP:%s (从 %s 提供服务)", site.StaticPort, activePath)
+	return nil
 }
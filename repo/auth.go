@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+
+	"git2Web/config"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// isSSHURL 判断仓库地址是否使用 SSH 协议（包括 git@host:org/repo.git 形式）
+func isSSHURL(repoURL string) bool {
+	ep, err := transport.NewEndpoint(repoURL)
+	return err == nil && ep.Protocol == "ssh"
+}
+
+// authMethod 根据配置生成仓库认证方式，未启用认证时返回 nil
+func authMethod(config *config.Site) (transport.AuthMethod, error) {
+	return authMethodFor(config.RepoURL, config.RepoAuth)
+}
+
+// authMethodFor 根据仓库地址的协议与认证信息生成认证方式
+func authMethodFor(repoURL string, auth config.RepoAuth) (transport.AuthMethod, error) {
+	if !auth.Enabled {
+		return nil, nil
+	}
+	if isSSHURL(repoURL) {
+		return sshAuth(repoURL, auth)
+	}
+	username, password, err := resolveCredentials(repoURL, auth)
+	if err != nil {
+		return nil, err
+	}
+	return &http.BasicAuth{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+// loadSSHKey 读取 SSH 私钥，优先使用文件路径，其次使用环境变量中的内容
+func loadSSHKey(auth config.RepoAuth) ([]byte, error) {
+	if auth.SSHKeyPath != "" {
+		key, err := os.ReadFile(auth.SSHKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取 SSH 私钥文件失败: %w", err)
+		}
+		return key, nil
+	}
+	if auth.SSHKeyEnv != "" {
+		if key := os.Getenv(auth.SSHKeyEnv); key != "" {
+			return []byte(key), nil
+		}
+	}
+	return nil, fmt.Errorf("未配置 SSH 私钥，请设置 ssh_key_path 或环境变量 %s", auth.SSHKeyEnv)
+}
+
+// sshAuth 生成使用部署密钥的 SSH 认证，并通过 known_hosts 校验主机密钥
+func sshAuth(repoURL string, auth config.RepoAuth) (*gitssh.PublicKeys, error) {
+	key, err := loadSSHKey(auth)
+	if err != nil {
+		return nil, err
+	}
+
+	user := gitssh.DefaultUsername
+	if ep, err := transport.NewEndpoint(repoURL); err == nil && ep.User != "" {
+		user = ep.User
+	}
+
+	keys, err := gitssh.NewPublicKeys(user, key, auth.SSHKeyPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("解析 SSH 私钥失败: %w", err)
+	}
+
+	// 未指定 known_hosts 时使用 SSH_KNOWN_HOSTS 或 ~/.ssh/known_hosts
+	var files []string
+	if auth.KnownHostsPath != "" {
+		files = append(files, auth.KnownHostsPath)
+	}
+	callback, err := gitssh.NewKnownHostsCallback(files...)
+	if err != nil {
+		return nil, fmt.Errorf("加载 known_hosts 失败: %w", err)
+	}
+	keys.HostKeyCallback = callback
+
+	return keys, nil
+}
@@ -0,0 +1,152 @@
+package repo
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"git2Web/config"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+)
+
+// UnbundleToPath 将 git bundle 中的提交检出到 targetPath，不需要访问远程仓库
+// seedPath 中已有仓库时先复用其对象，增量 bundle 依赖的提交可以从中获得
+func UnbundleToPath(config *config.Site, bundlePath, targetPath, seedPath string) error {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	refs, prerequisites, err := readBundleHeader(br)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("bundle 中没有任何引用")
+	}
+
+	if err := os.RemoveAll(targetPath); err != nil {
+		return fmt.Errorf("清理目标目录失败: %w", err)
+	}
+	var r *git.Repository
+	if err := seedPartition(seedPath, targetPath); err == nil {
+		r, err = git.PlainOpen(targetPath)
+		if err != nil {
+			return fmt.Errorf("打开仓库失败: %w", err)
+		}
+	} else {
+		if err := os.RemoveAll(targetPath); err != nil {
+			return fmt.Errorf("清理目标目录失败: %w", err)
+		}
+		if r, err = git.PlainInit(targetPath, false); err != nil {
+			return fmt.Errorf("初始化仓库失败: %w", err)
+		}
+	}
+
+	for _, hash := range prerequisites {
+		if _, err := r.CommitObject(hash); err != nil {
+			return fmt.Errorf("缺少 bundle 依赖的提交 %s，请上传完整的 bundle", hash)
+		}
+	}
+	if err := packfile.UpdateObjectStorage(r.Storer, br); err != nil {
+		return fmt.Errorf("写入 bundle 对象失败: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			continue
+		}
+		if err := r.Storer.SetReference(ref); err != nil {
+			return fmt.Errorf("更新引用 %s 失败: %w", ref.Name(), err)
+		}
+	}
+
+	target := selectBundleRef(refs, config.Branch)
+	log.Printf("从 bundle 检出 %s (%s) 到路径: %s", target.Name(), target.Hash(), targetPath)
+	if err := verifyCommitSignature(r, config, target.Hash()); err != nil {
+		return err
+	}
+	opts := &git.CheckoutOptions{Hash: target.Hash()}
+	if target.Name().IsBranch() {
+		opts = &git.CheckoutOptions{Branch: target.Name()}
+	}
+	if err := forceCheckout(r, opts, config.SparseCheckoutDirs()); err != nil {
+		return fmt.Errorf("检出失败: %w", err)
+	}
+	if err := cleanWorktree(r); err != nil {
+		return err
+	}
+
+	GetBranchInfo(targetPath)
+	return nil
+}
+
+// readBundleHeader 读取 v2/v3 bundle 的头部，返回包含的引用与依赖的提交，读取后 br 位于包数据的开头
+func readBundleHeader(br *bufio.Reader) ([]*plumbing.Reference, []plumbing.Hash, error) {
+	signature, err := br.ReadString('\n')
+	if err != nil || (signature != "# v2 git bundle\n" && signature != "# v3 git bundle\n") {
+		return nil, nil, fmt.Errorf("不是有效的 git bundle 文件")
+	}
+
+	var refs []*plumbing.Reference
+	var prerequisites []plumbing.Hash
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取 bundle 头部失败: %w", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return refs, prerequisites, nil
+		case strings.HasPrefix(line, "@"):
+			// v3 的能力声明，只支持 SHA-1 仓库
+			if strings.HasPrefix(line, "@object-format=") && line != "@object-format=sha1" {
+				return nil, nil, fmt.Errorf("不支持的对象格式: %s", strings.TrimPrefix(line, "@object-format="))
+			}
+		case strings.HasPrefix(line, "-"):
+			hash, _, _ := strings.Cut(line[1:], " ")
+			prerequisites = append(prerequisites, plumbing.NewHash(hash))
+		default:
+			hash, name, ok := strings.Cut(line, " ")
+			if !ok {
+				return nil, nil, fmt.Errorf("无效的 bundle 引用: %s", line)
+			}
+			refs = append(refs, plumbing.NewHashReference(plumbing.ReferenceName(name), plumbing.NewHash(hash)))
+		}
+	}
+}
+
+// selectBundleRef 选择需要检出的引用
+// 优先级: 配置的分支 > HEAD 指向的分支 > HEAD > 第一个分支 > 第一个引用
+func selectBundleRef(refs []*plumbing.Reference, branch string) *plumbing.Reference {
+	var head, firstBranch *plumbing.Reference
+	for _, ref := range refs {
+		switch {
+		case branch != "" && ref.Name() == plumbing.NewBranchReferenceName(branch):
+			return ref
+		case ref.Name() == plumbing.HEAD:
+			head = ref
+		case ref.Name().IsBranch() && firstBranch == nil:
+			firstBranch = ref
+		}
+	}
+	if head != nil {
+		for _, ref := range refs {
+			if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+				return ref
+			}
+		}
+		return head
+	}
+	if firstBranch != nil {
+		return firstBranch
+	}
+	return refs[0]
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"git2Web/config"
+)
+
+// credentialHelperTimeout 凭据助手的最长执行时间
+const credentialHelperTimeout = 30 * time.Second
+
+// resolveCredentials 在使用时解析 HTTPS 认证的用户名与密码，结果只保存在内存中，不会写回配置文件
+// 密码来源的优先级: 凭据助手 > 密码文件 > 密码环境变量 > 配置中的密码
+func resolveCredentials(repoURL string, auth config.RepoAuth) (string, string, error) {
+	username := auth.Email
+
+	if auth.CredentialHelper != "" {
+		user, password, err := credentialFromHelper(auth.CredentialHelper, repoURL)
+		if err != nil {
+			return "", "", err
+		}
+		if user != "" {
+			username = user
+		}
+		return username, password, nil
+	}
+
+	if auth.PasswordFile != "" {
+		data, err := os.ReadFile(auth.PasswordFile)
+		if err != nil {
+			return "", "", fmt.Errorf("读取密码文件失败: %w", err)
+		}
+		return username, strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if auth.PasswordEnv != "" {
+		if password := os.Getenv(auth.PasswordEnv); password != "" {
+			return username, password, nil
+		}
+	}
+
+	if auth.Password == "" {
+		return "", "", fmt.Errorf("未配置仓库密码，请设置 password_file、环境变量 %s 或 credential_helper", auth.PasswordEnv)
+	}
+	return username, auth.Password, nil
+}
+
+// credentialFromHelper 按 git 凭据助手协议调用外部命令获取凭据
+// 命令以 "<helper> get" 的形式通过 shell 执行，标准输入为 protocol/host/path，标准输出中读取 username/password
+func credentialFromHelper(helper, repoURL string) (string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("凭据助手只支持 HTTP(S) 仓库地址")
+	}
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", helper+" get")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", "", fmt.Errorf("执行凭据助手失败: %w: %s", err, msg)
+		}
+		return "", "", fmt.Errorf("执行凭据助手失败: %w", err)
+	}
+
+	var username, password string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "username":
+			username = value
+		case "password":
+			password = value
+		}
+	}
+	if password == "" {
+		return "", "", fmt.Errorf("凭据助手没有返回密码")
+	}
+	return username, password, nil
+}
@@ -2,66 +2,61 @@ package repo
 
 import (
 	"fmt"
+	"io"
 	"log"
-	"net/url"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"git2Web/config"
 
 	git "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-// GetBranchInfo 获取当前分支信息
-func GetBranchInfo(repoPath string) {
-	// 打开当前的 Git 仓库
-	repo, err := git.PlainOpen(repoPath)
+// CloneRepo 克隆仓库到默认路径
+func CloneRepo(config *config.Site) error {
+	return CloneRepoToPath(config, config.GetActiveTargetPath())
+}
+
+// CloneRepoToPath 克隆仓库到指定路径
+func CloneRepoToPath(config *config.Site, targetPath string) error {
+	auth, err := authMethod(config)
 	if err != nil {
-		log.Fatalf("无法打开仓库: %v", err)
+		return fmt.Errorf("准备仓库认证失败: %w", err)
 	}
-
-	// 获取当前 HEAD 的引用
-	headRef, err := repo.Head()
+	target, err := resolveDeployTarget(config, auth)
 	if err != nil {
-		log.Fatalf("无法获取 HEAD: %v", err)
+		return fmt.Errorf("解析部署目标失败: %w", err)
 	}
 
-	// 输出当前节点的信息
-	log.Printf("当前 HEAD Commit: %s\n", headRef.Hash().String())
-
-	// 判断 HEAD 是否指向分支
-	if headRef.Name().IsBranch() {
-		log.Printf("当前分支: %s\n", headRef.Name().Short())
-	} else {
-		log.Println("当前是一个分离的 HEAD 状态 (Detached HEAD)")
+	cloneOptions := &git.CloneOptions{
+		URL:           config.RepoURL,
+		Auth:          auth,
+		ReferenceName: target.RefName,
+		SingleBranch:  config.SingleBranch,
+		Depth:         config.CloneDepth,
 	}
 
-	commit, err := repo.CommitObject(headRef.Hash())
-	if err != nil {
-		log.Fatalf("无法获取 Commit 对象: %v", err)
+	// 克隆不支持分支与标签以外的引用，先克隆默认分支再单独获取并检出
+	customRef := target.isCustomRef()
+	if customRef {
+		cloneOptions.ReferenceName = ""
+		cloneOptions.NoCheckout = true
 	}
-	log.Printf("当前的提交信息: %s", commit.Message)
-}
-
-// CloneRepo 克隆仓库到默认路径
-func CloneRepo(config *config.Config) error {
-	return CloneRepoToPath(config, config.GetActiveTargetPath())
-}
 
-// CloneRepoToPath 克隆仓库到指定路径
-func CloneRepoToPath(config *config.Config, targetPath string) error {
-	cloneOptions := &git.CloneOptions{
-		URL: config.RepoURL,
+	// 固定提交可能不在浅克隆的历史中，需要完整克隆
+	if target.Revision != "" && cloneOptions.Depth > 0 {
+		log.Println("已指定固定提交，忽略 clone_depth 进行完整克隆")
+		cloneOptions.Depth = 0
+		cloneOptions.SingleBranch = false
 	}
 
-	// 如果需要认证，设置认证信息
-	if config.RepoAuth.Enabled {
-		cloneOptions.Auth = &http.BasicAuth{
-			Username: config.RepoAuth.Email,
-			Password: config.RepoAuth.Password,
-		}
-	}
+	// 稀疏检出时克隆后再只检出发布的目录，其余文件不写入磁盘；
+	// 验证签名时克隆后先验证再检出
+	sparseDirs := config.SparseCheckoutDirs()
+	cloneOptions.NoCheckout = cloneOptions.NoCheckout || len(sparseDirs) > 0 || config.Signature != nil
 
 	// 确保目标路径存在
 	if err := os.MkdirAll(targetPath, 0755); err != nil {
@@ -69,12 +64,34 @@ func CloneRepoToPath(config *config.Config, targetPath string) error {
 	}
 
 	// 克隆仓库
-	log.Printf("开始克隆仓库: %s 到路径: %s", config.RepoURL, targetPath)
-	_, err := git.PlainClone(targetPath, false, cloneOptions)
+	log.Printf("开始克隆仓库: %s (%s) 到路径: %s", config.RepoURL, config.DescribeTargetRef(), targetPath)
+	r, err := git.PlainClone(targetPath, false, cloneOptions)
 	if err != nil {
 		return fmt.Errorf("克隆仓库失败: %w", err)
 	}
 
+	// 固定提交与其他引用需要在克隆后单独检出
+	if target.Revision != "" || customRef {
+		if err := checkoutTarget(r, config, target, auth); err != nil {
+			return fmt.Errorf("检出部署目标失败: %w", err)
+		}
+	} else if cloneOptions.NoCheckout {
+		head, err := r.Head()
+		if err != nil {
+			return fmt.Errorf("获取 HEAD 失败: %w", err)
+		}
+		if err := verifyCommitSignature(r, config, head.Hash()); err != nil {
+			return err
+		}
+		if err := checkoutSparse(r, sparseDirs); err != nil {
+			return fmt.Errorf("检出失败: %w", err)
+		}
+	}
+
+	if err := updateSubmodules(r, config, config.RepoURL, config.SubmoduleDepth, false); err != nil {
+		return err
+	}
+
 	log.Println("仓库克隆完成")
 
 	// 如果启用了 LFS，执行 LFS 拉取
@@ -83,114 +100,259 @@ func CloneRepoToPath(config *config.Config, targetPath string) error {
 			return fmt.Errorf("git LFS 拉取失败: %w", err)
 		}
 	}
-	
+
 	GetBranchInfo(targetPath)
 
 	return nil
 }
 
-// PullRepo 拉取更新
-func PullRepo(config *config.Config) error {
-    targetPath := config.GetActiveTargetPath()
-    
-    // 如果启用了 LFS，可以在这里处理 AB 分区策略
-    // 但实际实现在 server 包中的 webhookHandler 中
-    if config.LfsEnabled {
-        log.Println("已启用 LFS 和 AB 分区策略，通过 webhook 处理...")
-        return nil
-    }
-
-    // 打开已有的仓库
-    repo, err := git.PlainOpen(targetPath)
-    if err != nil {
-        return fmt.Errorf("打开仓库失败: %w", err)
-    }
-
-    // 获取工作树
-    w, err := repo.Worktree()
-    if err != nil {
-        return fmt.Errorf("获取工作树失败: %w", err)
-    }
-
-    // 设置拉取选项
-    pullOptions := &git.PullOptions{
-        RemoteName: "origin",
-    }
-
-    if config.RepoAuth.Enabled {
-        pullOptions.Auth = &http.BasicAuth{
-            Username: config.RepoAuth.Email,
-            Password: config.RepoAuth.Password,
-        }
-    }
-
-    // 执行拉取操作
-    log.Println("开始拉取仓库更新")
-    err = w.Pull(pullOptions)
-    if err != nil {
-        if err.Error() == "already up-to-date" {
-            log.Println("仓库已经是最新状态")
-            return nil
-        }
-        return fmt.Errorf("拉取仓库更新失败: %w", err)
-    }
-
-    log.Println("仓库更新完成")
-	GetBranchInfo(targetPath)
+// RecloneRepo 将仓库克隆到临时目录，成功后再替换 targetPath，
+// 克隆失败时保留原有仓库不变
+func RecloneRepo(config *config.Site, targetPath string) error {
+	tmpPath := targetPath + ".tmp"
+	oldPath := targetPath + ".old"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return fmt.Errorf("清理临时目录失败: %w", err)
+	}
+	if err := CloneRepoToPath(config, tmpPath); err != nil {
+		os.RemoveAll(tmpPath)
+		return err
+	}
+
+	if err := os.RemoveAll(oldPath); err != nil {
+		return fmt.Errorf("清理旧目录失败: %w", err)
+	}
+	if err := os.Rename(targetPath, oldPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("移走现有仓库失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, targetPath); err != nil {
+		os.Rename(oldPath, targetPath)
+		return fmt.Errorf("替换仓库失败: %w", err)
+	}
+	return os.RemoveAll(oldPath)
+}
 
-    return nil
+// checkoutSparse 将克隆后未检出的工作树按稀疏目录检出到 HEAD
+func checkoutSparse(r *git.Repository, dirs []string) error {
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	opts := &git.CheckoutOptions{}
+	if head.Name().IsBranch() {
+		opts.Branch = head.Name()
+	} else {
+		opts.Hash = head.Hash()
+	}
+	return forceCheckout(r, opts, dirs)
 }
 
-// updateGitLFS 使用命令行工具拉取 Git LFS 文件
-func updateGitLFS(targetPath string, config *config.Config) error {
-	log.Println("开始更新 Git LFS 文件")
-
-	// 如果需要认证，临时设置带认证信息的远程 URL
-	originURL := config.RepoURL
-	authURL := originURL
-	needRestore := false
-
-	if config.RepoAuth.Enabled {
-		needRestore = true
-		authURL = originURL
-		if len(config.RepoAuth.Email) > 0 && len(config.RepoAuth.Password) > 0 {
-			const prefix = "https://"
-			if len(originURL) > len(prefix) && originURL[:len(prefix)] == prefix {
-				// 对用户名和密码做 URL 编码
-				encodedUser := url.QueryEscape(config.RepoAuth.Email)
-				encodedPass := url.QueryEscape(config.RepoAuth.Password)
-				authURL = fmt.Sprintf("https://%s:%s@%s", encodedUser, encodedPass, originURL[len(prefix):])
+// forceCheckout 强制检出，sparseDirs 非空时只将这些目录写入工作树
+func forceCheckout(r *git.Repository, opts *git.CheckoutOptions, sparseDirs []string) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("获取工作树失败: %w", err)
+	}
+	if len(sparseDirs) == 0 {
+		opts.Force = true
+		return w.Checkout(opts)
+	}
+
+	// 只更新 HEAD 和索引，工作树由下面按稀疏目录写入
+	opts.Keep = true
+	if err := w.Checkout(opts); err != nil {
+		return err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MixedReset}); err != nil {
+		return err
+	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	// 清空工作树（保留 .git），再只写入稀疏目录中的文件和 .gitmodules
+	root := w.Filesystem.Root()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() != ".git" {
+			if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+				return err
 			}
 		}
-		// 设置远程 URL
-		cmdSet := exec.Command("git", "remote", "set-url", "origin", authURL)
-		cmdSet.Dir = targetPath
-		if output, err := cmdSet.CombinedOutput(); err != nil {
-			return fmt.Errorf("设置带认证信息的远程 URL 失败: %s, 错误信息: %s", err, string(output))
+	}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if f.Name != ".gitmodules" && !inSparseDirs(f.Name, sparseDirs) {
+			return nil
 		}
+		return writeTreeFile(root, f)
+	})
+	if err != nil {
+		return fmt.Errorf("写入稀疏目录失败: %w", err)
 	}
 
-	// 执行 git lfs pull
-	cmd := exec.Command("git", "lfs", "pull")
-	cmd.Dir = targetPath
-	output, err := cmd.CombinedOutput()
+	// 在索引中标记稀疏目录以外的条目，使工作树状态保持干净
+	idx, err := r.Storer.Index()
 	if err != nil {
-		// 恢复远程 URL
-		if needRestore {
-			cmdRestore := exec.Command("git", "remote", "set-url", "origin", originURL)
-			cmdRestore.Dir = targetPath
-			cmdRestore.CombinedOutput()
+		return err
+	}
+	for _, e := range idx.Entries {
+		e.SkipWorktree = !inSparseDirs(e.Name, sparseDirs)
+	}
+	return r.Storer.SetIndex(idx)
+}
+
+// inSparseDirs 判断仓库内路径是否位于稀疏目录中
+func inSparseDirs(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTreeFile 将树中的文件写入工作树
+func writeTreeFile(root string, f *object.File) error {
+	name := filepath.Join(root, filepath.FromSlash(f.Name))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	if f.Mode == filemode.Symlink {
+		target, err := f.Contents()
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("git LFS 更新失败: %s, 错误信息: %s", err, string(output))
+		return os.Symlink(target, name)
+	}
+
+	perm := os.FileMode(0644)
+	if f.Mode == filemode.Executable {
+		perm = 0755
+	}
+	reader, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	out, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// PullRepo 拉取更新
+func PullRepo(config *config.Site) error {
+	targetPath := config.GetActiveTargetPath()
+
+	// 如果启用了 LFS 或构建，可以在这里处理 AB 分区策略
+	// 但实际实现在 server 包中的 webhookHandler 中
+	if config.UsePartitions() {
+		log.Println("已启用 AB 分区策略，通过 webhook 处理...")
+		return nil
 	}
 
-	// 恢复远程 URL
-	if needRestore {
-		cmdRestore := exec.Command("git", "remote", "set-url", "origin", originURL)
-		cmdRestore.Dir = targetPath
-		cmdRestore.CombinedOutput()
+	// 打开已有的仓库
+	repo, err := git.PlainOpen(targetPath)
+	if err != nil {
+		return fmt.Errorf("打开仓库失败: %w", err)
 	}
 
-	log.Println("Git LFS 更新完成")
+	auth, err := authMethod(config)
+	if err != nil {
+		return fmt.Errorf("准备仓库认证失败: %w", err)
+	}
+	target, err := resolveDeployTarget(config, auth)
+	if err != nil {
+		return fmt.Errorf("解析部署目标失败: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("获取 HEAD 失败: %w", err)
+	}
+
+	// 未指定目标时跟随当前分支，处于分离 HEAD 时回到远程默认分支
+	if target.RefName == "" && target.Revision == "" {
+		if head.Name().IsBranch() {
+			target.RefName = head.Name()
+		} else if target.RefName, err = remoteDefaultBranch(config.RepoURL, auth); err != nil {
+			return err
+		}
+	}
+
+	// reset 策略、签名验证、标签、固定提交、稀疏检出或切换了分支时，直接获取并强制检出目标
+	// 强制检出等同于硬重置，因此强制推送或历史分叉时也能更新
+	if config.UseResetSync() || config.Signature != nil || target.Revision != "" || target.RefName.IsTag() ||
+		len(config.SparseCheckoutDirs()) > 0 || head.Name() != target.RefName {
+		log.Printf("开始获取并检出部署目标: %s", config.DescribeTargetRef())
+		if err := checkoutTarget(repo, config, target, auth); err != nil {
+			return fmt.Errorf("检出部署目标失败: %w", err)
+		}
+		if config.UseResetSync() {
+			if err := cleanWorktree(repo); err != nil {
+				return err
+			}
+		}
+		if err := updateSubmodules(repo, config, config.RepoURL, config.SubmoduleDepth, false); err != nil {
+			return err
+		}
+		log.Println("仓库更新完成")
+		GetBranchInfo(targetPath)
+		return nil
+	}
+
+	// 获取工作树
+	w, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("获取工作树失败: %w", err)
+	}
+
+	// 设置拉取选项
+	pullOptions := &git.PullOptions{
+		RemoteName:    "origin",
+		ReferenceName: target.RefName,
+		SingleBranch:  config.SingleBranch,
+		Depth:         config.CloneDepth,
+		Auth:          auth,
+	}
+
+	// 执行拉取操作
+	log.Println("开始拉取仓库更新")
+	err = w.Pull(pullOptions)
+	if err != nil {
+		if err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("拉取仓库更新失败: %w", err)
+		}
+		log.Println("仓库已经是最新状态")
+	}
+
+	// 即使主仓库没有更新，也确保子模块与记录的提交一致
+	if err := updateSubmodules(repo, config, config.RepoURL, config.SubmoduleDepth, false); err != nil {
+		return err
+	}
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+
+	log.Println("仓库更新完成")
+	GetBranchInfo(targetPath)
+
 	return nil
 }
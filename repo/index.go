@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// TrackedFile 暂存区中记录的文件
+type TrackedFile struct {
+	// Hash 文件内容的 git 对象哈希
+	Hash string
+	// Size 与 ModTime 为检出时记录的文件大小与修改时间，与工作区中的文件一致时说明文件未被修改
+	Size    int64
+	ModTime time.Time
+}
+
+// TrackedFiles 返回仓库暂存区中的文件，键为相对仓库根目录、以 / 分隔的路径
+// 目录不是 git 仓库（如上传的构建产物）时返回空
+func TrackedFiles(repoPath string) (map[string]TrackedFile, error) {
+	r, err := git.PlainOpen(repoPath)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开仓库失败: %w", err)
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("读取暂存区失败: %w", err)
+	}
+	files := make(map[string]TrackedFile, len(idx.Entries))
+	for _, e := range idx.Entries {
+		files[e.Name] = TrackedFile{
+			Hash:    e.Hash.String(),
+			Size:    int64(e.Size),
+			ModTime: e.ModifiedAt,
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,535 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git2Web/config"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	lfsMediaType      = "application/vnd.git-lfs+json"
+	// lfsMaxPointerSize 指针文件的最大长度，超过此大小的文件不做解析
+	lfsMaxPointerSize = 1024
+	// lfsBatchSize 每次批量请求包含的对象数
+	lfsBatchSize = 100
+	// defaultLFSTimeout 未配置 lfs_timeout_sec 时单个请求的最长时间，包括读取响应内容
+	defaultLFSTimeout = 10 * time.Minute
+	// lfsResponseHeaderTimeout 发出请求后等待响应头的最长时间，尽早发现无响应的服务
+	lfsResponseHeaderTimeout = 60 * time.Second
+)
+
+// lfsPointer LFS 指针文件描述的对象
+type lfsPointer struct {
+	Oid  string
+	Size int64
+}
+
+// lfsObject 批量 API 中的对象
+type lfsObject struct {
+	Oid     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions,omitempty"`
+	Error   *lfsObjectError      `json:"error,omitempty"`
+}
+
+// lfsAction 对象的传输动作
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+// lfsObjectError 单个对象的错误信息
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// lfsBatchRequest 批量 API 请求
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []lfsObject `json:"objects"`
+}
+
+// lfsBatchResponse 批量 API 响应
+type lfsBatchResponse struct {
+	Objects []lfsObject `json:"objects"`
+	Message string      `json:"message"`
+}
+
+// lfsClient 通过 LFS 批量 API 下载对象
+type lfsClient struct {
+	endpoint string
+	header   map[string]string
+	username string
+	password string
+	client   *http.Client
+}
+
+// updateGitLFS 查找工作树中的 LFS 指针文件，下载对应对象并替换为实际内容
+// 对象缓存在 .git/lfs/objects 中，已存在或可从 seedPaths 仓库借用的对象不会重复下载
+func updateGitLFS(targetPath string, config *config.Site, seedPaths ...string) error {
+	log.Println("开始更新 Git LFS 文件")
+
+	pointers, err := findLFSPointers(targetPath)
+	if err != nil {
+		return fmt.Errorf("扫描 LFS 指针文件失败: %w", err)
+	}
+	if len(pointers) == 0 {
+		log.Println("未发现 LFS 指针文件")
+		return nil
+	}
+
+	// 相同对象只下载一次
+	objects := make(map[string]lfsPointer)
+	for _, p := range pointers {
+		objects[p.Oid] = p
+	}
+
+	var missing []lfsObject
+	for oid, p := range objects {
+		if !lfsObjectCached(targetPath, p) && !borrowLFSObject(targetPath, p, seedPaths) {
+			missing = append(missing, lfsObject{Oid: oid, Size: p.Size})
+		}
+	}
+	log.Printf("发现 %d 个 LFS 指针文件，%d 个对象，需下载 %d 个", len(pointers), len(objects), len(missing))
+
+	if len(missing) > 0 {
+		client, err := newLFSClient(config)
+		if err != nil {
+			return err
+		}
+		if err := client.download(targetPath, missing, config.LfsConcurrency); err != nil {
+			return err
+		}
+	}
+
+	// 用对象内容替换指针文件
+	for path, p := range pointers {
+		if err := smudgeLFSFile(targetPath, path, p); err != nil {
+			return err
+		}
+	}
+
+	log.Println("Git LFS 更新完成")
+	return nil
+}
+
+// parseLFSPointer 解析 LFS 指针文件内容，不是指针文件时返回 false
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	var p lfsPointer
+	if !bytes.HasPrefix(data, []byte(lfsPointerVersion)) {
+		return p, false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "oid":
+			p.Oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			p.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if !validLFSOid(p.Oid) {
+		return p, false
+	}
+	return p, true
+}
+
+// validLFSOid 判断 oid 是否为小写十六进制的 sha256，对象路径由 oid 拼接而成，不能包含其他字符
+func validLFSOid(oid string) bool {
+	if len(oid) != sha256.Size*2 {
+		return false
+	}
+	for i := 0; i < len(oid); i++ {
+		c := oid[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// findLFSPointers 遍历工作树，返回相对路径到指针的映射
+func findLFSPointers(root string) (map[string]lfsPointer, error) {
+	pointers := make(map[string]lfsPointer)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			// 子模块有各自的 LFS 服务，不在主仓库中处理
+			if _, err := os.Lstat(filepath.Join(path, ".git")); err == nil && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > lfsMaxPointerSize {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if p, ok := parseLFSPointer(data); ok {
+			rel, _ := filepath.Rel(root, path)
+			pointers[rel] = p
+		}
+		return nil
+	})
+	return pointers, err
+}
+
+// FindLFSPointerFiles 返回工作树中仍为 LFS 指针的文件，用于确认对象已全部下载
+func FindLFSPointerFiles(root string) ([]string, error) {
+	pointers, err := findLFSPointers(root)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(pointers))
+	for rel := range pointers {
+		files = append(files, filepath.ToSlash(rel))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// lfsObjectPath 返回对象在本地 LFS 存储中的路径，与 git-lfs 的目录布局一致
+func lfsObjectPath(repoPath, oid string) string {
+	return filepath.Join(repoPath, ".git", "lfs", "objects", oid[0:2], oid[2:4], oid)
+}
+
+// lfsObjectCached 判断对象是否已存在于本地 LFS 存储
+func lfsObjectCached(repoPath string, p lfsPointer) bool {
+	info, err := os.Stat(lfsObjectPath(repoPath, p.Oid))
+	return err == nil && info.Size() == p.Size
+}
+
+// borrowLFSObject 尝试从其他仓库的 LFS 存储硬链接（或复制）已下载的对象
+func borrowLFSObject(repoPath string, p lfsPointer, seedPaths []string) bool {
+	dst := lfsObjectPath(repoPath, p.Oid)
+	for _, seed := range seedPaths {
+		if seed == "" || !lfsObjectCached(seed, p) {
+			continue
+		}
+		src := lfsObjectPath(seed, p.Oid)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return false
+		}
+		if os.Link(src, dst) == nil || copyFile(src, dst) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// smudgeLFSFile 将工作树中的指针文件替换为对象内容
+func smudgeLFSFile(repoPath, relPath string, p lfsPointer) error {
+	src, err := os.Open(lfsObjectPath(repoPath, p.Oid))
+	if err != nil {
+		return fmt.Errorf("打开 LFS 对象 %s 失败: %w", p.Oid, err)
+	}
+	defer src.Close()
+
+	dstPath := filepath.Join(repoPath, relPath)
+	tmp := dstPath + ".lfs-tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("写入 LFS 文件 %s 失败: %w", relPath, err)
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入 LFS 文件 %s 失败: %w", relPath, err)
+	}
+	return os.Rename(tmp, dstPath)
+}
+
+// newLFSClient 根据仓库地址确定 LFS 端点与认证信息
+// 请求有超时限制，LFS 服务无响应时更新失败，而不是一直占用站点锁
+func newLFSClient(config *config.Site) (*lfsClient, error) {
+	timeout := defaultLFSTimeout
+	if config.LfsTimeoutSec > 0 {
+		timeout = time.Duration(config.LfsTimeoutSec) * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = lfsResponseHeaderTimeout
+	c := &lfsClient{client: &http.Client{Transport: transport, Timeout: timeout}}
+
+	if isSSHURL(config.RepoURL) && config.LfsURL == "" {
+		// SSH 仓库通过 git-lfs-authenticate 获取 HTTP 端点与临时凭据
+		endpoint, header, err := sshLFSAuthenticate(config)
+		if err != nil {
+			return nil, fmt.Errorf("LFS SSH 认证失败: %w", err)
+		}
+		c.endpoint = endpoint
+		c.header = header
+		return c, nil
+	}
+
+	c.endpoint = config.LfsURL
+	if c.endpoint == "" {
+		c.endpoint = strings.TrimSuffix(config.RepoURL, "/")
+		if !strings.HasSuffix(c.endpoint, ".git") {
+			c.endpoint += ".git"
+		}
+		c.endpoint += "/info/lfs"
+	}
+	if config.RepoAuth.Enabled && !isSSHURL(config.RepoURL) {
+		username, password, err := resolveCredentials(config.RepoURL, config.RepoAuth)
+		if err != nil {
+			return nil, err
+		}
+		c.username = username
+		c.password = password
+	}
+	return c, nil
+}
+
+// sshLFSAuthenticate 通过 SSH 执行 git-lfs-authenticate，返回 LFS 端点与请求头
+func sshLFSAuthenticate(config *config.Site) (string, map[string]string, error) {
+	ep, err := transport.NewEndpoint(config.RepoURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var auth gitssh.AuthMethod
+	if config.RepoAuth.Enabled {
+		auth, err = sshAuth(config.RepoURL, config.RepoAuth)
+	} else {
+		auth, err = gitssh.DefaultAuthBuilder(ep.User)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	clientConfig, err := auth.ClientConfig()
+	if err != nil {
+		return "", nil, err
+	}
+
+	port := ep.Port
+	if port == 0 {
+		port = 22
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(ep.Host, strconv.Itoa(port)), clientConfig)
+	if err != nil {
+		return "", nil, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", nil, err
+	}
+	defer session.Close()
+
+	output, err := session.Output("git-lfs-authenticate '" + strings.TrimPrefix(ep.Path, "/") + "' download")
+	if err != nil {
+		return "", nil, err
+	}
+
+	var result lfsAction
+	if err := json.Unmarshal(output, &result); err != nil {
+		return "", nil, fmt.Errorf("解析 git-lfs-authenticate 响应失败: %w", err)
+	}
+	return result.Href, result.Header, nil
+}
+
+// setAuth 为请求设置认证信息，仓库凭据只发送给 LFS 端点所在的主机
+func (c *lfsClient) setAuth(req *http.Request, header map[string]string) {
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Authorization") != "" || c.username == "" {
+		return
+	}
+	if endpoint, err := url.Parse(c.endpoint); err == nil && endpoint.Host == req.URL.Host {
+		req.SetBasicAuth(c.username, c.password)
+	}
+}
+
+// batch 调用 LFS 批量 API 获取对象的下载地址
+func (c *lfsClient) batch(objects []lfsObject) ([]lfsObject, error) {
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   objects,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	c.setAuth(req, c.header)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("LFS 批量请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("解析 LFS 批量响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LFS 批量请求返回 %s: %s", resp.Status, result.Message)
+	}
+	return result.Objects, nil
+}
+
+// download 分批获取下载地址，并以指定并发数下载对象到本地 LFS 存储
+func (c *lfsClient) download(repoPath string, objects []lfsObject, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	queue := make(chan lfsObject)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range queue {
+				if err := c.downloadObject(repoPath, obj); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	requested := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		requested[obj.Oid] = true
+	}
+
+	var batchErr error
+	for start := 0; start < len(objects) && batchErr == nil; start += lfsBatchSize {
+		end := min(start+lfsBatchSize, len(objects))
+		result, err := c.batch(objects[start:end])
+		if err != nil {
+			batchErr = err
+			break
+		}
+		for _, obj := range result {
+			// 只接受请求过的对象，oid 决定写入的路径
+			if !validLFSOid(obj.Oid) || !requested[obj.Oid] {
+				batchErr = fmt.Errorf("LFS 批量响应包含无效的对象 %q", obj.Oid)
+				break
+			}
+			if obj.Error != nil {
+				batchErr = fmt.Errorf("LFS 对象 %s 不可用: %d %s", obj.Oid, obj.Error.Code, obj.Error.Message)
+				break
+			}
+			queue <- obj
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if batchErr != nil {
+		return batchErr
+	}
+	return firstErr
+}
+
+// downloadObject 下载单个对象并校验 sha256 后写入本地 LFS 存储
+func (c *lfsClient) downloadObject(repoPath string, obj lfsObject) error {
+	if !validLFSOid(obj.Oid) {
+		return fmt.Errorf("无效的 LFS 对象 %q", obj.Oid)
+	}
+	action, ok := obj.Actions["download"]
+	if !ok {
+		// 服务端已有对象但未返回下载动作，说明无需下载
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, action.Href, nil)
+	if err != nil {
+		return err
+	}
+	c.setAuth(req, action.Header)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("下载 LFS 对象 %s 失败: %w", obj.Oid, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载 LFS 对象 %s 失败: %s", obj.Oid, resp.Status)
+	}
+
+	objectPath := lfsObjectPath(repoPath, obj.Oid)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), obj.Oid+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("下载 LFS 对象 %s 失败: %w", obj.Oid, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != obj.Oid || size != obj.Size {
+		return fmt.Errorf("LFS 对象 %s 校验失败: 实际 sha256 %s, 大小 %d", obj.Oid, sum, size)
+	}
+
+	return os.Rename(tmp.Name(), objectPath)
+}
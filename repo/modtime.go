@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// maxModTimeCommits 查找修改时间时最多回溯的提交数，超出后未找到的条目视为未知
+const maxModTimeCommits = 2000
+
+// LastModified 返回仓库中目录下各条目最后一次被提交修改的时间，dir 为工作区中的目录
+// 沿第一父提交回溯，子目录的时间为其中任一文件最后修改的时间；未提交的文件（如构建输出）、
+// 浅克隆中早于最早提交的修改以及超过回溯上限的条目不在结果中
+func LastModified(repoPath, dir string) (map[string]time.Time, error) {
+	rel, err := filepath.Rel(repoPath, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("目录 %s 不在仓库 %s 中", dir, repoPath)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		rel = ""
+	}
+
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开仓库失败: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("获取 HEAD 失败: %w", err)
+	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("获取提交对象失败: %w", err)
+	}
+
+	// pending 中的条目在已回溯的提交中都没有变化
+	pending := treeEntries(commit, rel)
+	result := make(map[string]time.Time, len(pending))
+	for i := 0; len(pending) > 0 && i < maxModTimeCommits; i++ {
+		if commit.NumParents() == 0 {
+			for name := range pending {
+				result[name] = commit.Committer.When
+			}
+			break
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			// 浅克隆缺少更早的提交
+			break
+		}
+		parentEntries := treeEntries(parent, rel)
+		for name, hash := range pending {
+			if parentEntries[name] != hash {
+				result[name] = commit.Committer.When
+				delete(pending, name)
+			}
+		}
+		commit = parent
+	}
+	return result, nil
+}
+
+// treeEntries 返回提交中目录下各条目的对象哈希，目录不存在时返回空
+func treeEntries(commit *object.Commit, dir string) map[string]plumbing.Hash {
+	entries := make(map[string]plumbing.Hash)
+	tree, err := commit.Tree()
+	if err != nil {
+		return entries
+	}
+	if dir != "" {
+		if tree, err = tree.Tree(dir); err != nil {
+			return entries
+		}
+	}
+	for _, e := range tree.Entries {
+		entries[e.Name] = e.Hash
+	}
+	return entries
+}
@@ -0,0 +1,225 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"git2Web/config"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// errPartitionUnusable 分区中的仓库无法打开，也无法从其他分区复用对象
+var errPartitionUnusable = errors.New("分区不可用")
+
+// SyncPartition 增量更新分区: 复用分区中已有的仓库只获取新对象，
+// 分区不可用时从 seedPath（通常为活动分区）复用对象，仍不可用或仓库已损坏时才重新克隆；
+// 获取、LFS、子模块与签名验证等错误重新克隆也无法解决，直接返回并保留分区中的对象
+func SyncPartition(config *config.Site, targetPath, seedPath string) error {
+	err := updatePartition(config, targetPath, seedPath)
+	if err == nil || !partitionBroken(err) {
+		return err
+	}
+	log.Printf("增量更新分区失败: %v，将重新克隆", err)
+	if err := os.RemoveAll(targetPath); err != nil {
+		return fmt.Errorf("清理分区失败: %w", err)
+	}
+	return CloneRepoToPath(config, targetPath)
+}
+
+// partitionBroken 判断错误是否因分区中的仓库不可用或缺少对象引起，需要重新克隆
+func partitionBroken(err error) bool {
+	return errors.Is(err, errPartitionUnusable) || errors.Is(err, plumbing.ErrObjectNotFound)
+}
+
+// updatePartition 在分区已有仓库的基础上获取更新并强制检出部署目标
+func updatePartition(config *config.Site, targetPath, seedPath string) error {
+	r, err := openPartition(targetPath, config.RepoURL)
+	if err != nil {
+		log.Printf("分区 %s 不可复用 (%v)，尝试从 %s 复用对象", targetPath, err, seedPath)
+		if err := os.RemoveAll(targetPath); err != nil {
+			return fmt.Errorf("清理分区失败: %w", err)
+		}
+		if err := seedPartition(seedPath, targetPath); err != nil {
+			return fmt.Errorf("%w: 复用对象失败: %v", errPartitionUnusable, err)
+		}
+		if r, err = openPartition(targetPath, config.RepoURL); err != nil {
+			return fmt.Errorf("%w: %v", errPartitionUnusable, err)
+		}
+	}
+
+	auth, err := authMethod(config)
+	if err != nil {
+		return fmt.Errorf("准备仓库认证失败: %w", err)
+	}
+	target, err := resolveDeployTarget(config, auth)
+	if err != nil {
+		return fmt.Errorf("解析部署目标失败: %w", err)
+	}
+	if target.RefName == "" && target.Revision == "" {
+		if target.RefName, err = remoteDefaultBranch(config.RepoURL, auth); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("增量更新分区 %s 到 %s", targetPath, config.DescribeTargetRef())
+	if err := checkoutTarget(r, config, target, auth); err != nil {
+		return err
+	}
+	if err := cleanWorktree(r); err != nil {
+		return err
+	}
+	if err := updateSubmodules(r, config, config.RepoURL, config.SubmoduleDepth, false); err != nil {
+		return err
+	}
+
+	if config.LfsEnabled {
+		if err := updateGitLFS(targetPath, config, seedPath); err != nil {
+			return fmt.Errorf("git LFS 拉取失败: %w", err)
+		}
+	}
+
+	GetBranchInfo(targetPath)
+	return nil
+}
+
+// openPartition 打开分区中的仓库，并确认其远程地址与配置一致
+func openPartition(path, repoURL string) (*git.Repository, error) {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开仓库失败: %w", err)
+	}
+	remote, err := r.Remote("origin")
+	if err != nil {
+		return nil, fmt.Errorf("获取远程 origin 失败: %w", err)
+	}
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != repoURL {
+		return nil, fmt.Errorf("远程地址已变更")
+	}
+	return r, nil
+}
+
+// cleanWorktree 删除工作树中未跟踪的文件和目录
+func cleanWorktree(r *git.Repository) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("获取工作树失败: %w", err)
+	}
+	if err := w.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("清理未跟踪文件失败: %w", err)
+	}
+	return nil
+}
+
+// seedPartition 将 srcPath 的 .git 目录复制到 dstPath，
+// 不可变的对象文件（包括 LFS 对象）使用硬链接以节省磁盘和 I/O
+func seedPartition(srcPath, dstPath string) error {
+	srcGit := filepath.Join(srcPath, ".git")
+	dstGit := filepath.Join(dstPath, ".git")
+	if _, err := os.Stat(srcGit); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(srcGit, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(srcGit, path)
+		dst := filepath.Join(dstGit, rel)
+		if d.IsDir() {
+			if rel == filepath.Join("lfs", "tmp") {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(dst, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if isImmutableObject(rel) && os.Link(path, dst) == nil {
+			return nil
+		}
+		return copyFile(path, dst)
+	})
+}
+
+// isImmutableObject 判断 .git 下的文件是否为内容寻址的对象文件（包括子模块的对象）
+func isImmutableObject(rel string) bool {
+	rel = "/" + filepath.ToSlash(rel)
+	return strings.Contains(rel, "/objects/") && !strings.Contains(rel, "/objects/info/")
+}
+
+// copyFile 复制单个文件
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// CheckoutCommit 在不访问网络的情况下将仓库强制检出到本地已有的提交，用于回滚
+// 仓库不存在时从 seedPath 复用对象；提交对象不在本地时返回错误
+func CheckoutCommit(config *config.Site, repoPath, commit, seedPath string) error {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil && seedPath != "" {
+		log.Printf("分区 %s 不可用 (%v)，从 %s 复用对象", repoPath, err, seedPath)
+		if err := os.RemoveAll(repoPath); err != nil {
+			return fmt.Errorf("清理分区失败: %w", err)
+		}
+		if err := seedPartition(seedPath, repoPath); err != nil {
+			return fmt.Errorf("复用对象失败: %w", err)
+		}
+		r, err = git.PlainOpen(repoPath)
+	}
+	if err != nil {
+		return fmt.Errorf("打开仓库失败: %w", err)
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(commit))
+	if err != nil {
+		return fmt.Errorf("本地仓库中找不到提交 %s: %w", commit, err)
+	}
+	if err := verifyCommitSignature(r, config, *hash); err != nil {
+		return err
+	}
+
+	log.Printf("检出本地提交 %s 到 %s", hash.String(), repoPath)
+	if err := forceCheckout(r, &git.CheckoutOptions{Hash: *hash}, config.SparseCheckoutDirs()); err != nil {
+		return fmt.Errorf("检出提交失败: %w", err)
+	}
+	if err := cleanWorktree(r); err != nil {
+		return err
+	}
+	if err := updateSubmodules(r, config, config.RepoURL, config.SubmoduleDepth, true); err != nil {
+		return err
+	}
+
+	if config.LfsEnabled {
+		if err := updateGitLFS(repoPath, config, seedPath); err != nil {
+			return fmt.Errorf("git LFS 拉取失败: %w", err)
+		}
+	}
+
+	GetBranchInfo(repoPath)
+	return nil
+}
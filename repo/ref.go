@@ -0,0 +1,340 @@
+package repo
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"git2Web/config"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// deployTarget 描述需要部署的 Git 引用
+type deployTarget struct {
+	// RefName 分支或标签引用，为空表示远程默认分支
+	RefName plumbing.ReferenceName
+	// Revision 固定的提交，非空时优先于 RefName
+	Revision string
+}
+
+// isCustomRef 部署目标是否为分支与标签以外的引用（如 refs/pull/1/head）
+func (t *deployTarget) isCustomRef() bool {
+	return t.RefName != "" && !t.RefName.IsBranch() && !t.RefName.IsTag()
+}
+
+// resolveDeployTarget 根据配置解析需要部署的引用
+// 优先级: 引用 > 固定提交 > 标签模式 > 分支 > 远程默认分支
+func resolveDeployTarget(config *config.Site, auth transport.AuthMethod) (*deployTarget, error) {
+	if config.Ref != "" {
+		return &deployTarget{RefName: plumbing.ReferenceName(config.Ref)}, nil
+	}
+	if config.PinnedCommit != "" {
+		return &deployTarget{Revision: config.PinnedCommit}, nil
+	}
+
+	if config.TagPattern != "" {
+		tag, err := latestRemoteTag(config.RepoURL, config.TagPattern, auth)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("标签模式 %s 匹配到最新标签: %s", config.TagPattern, tag)
+		return &deployTarget{RefName: plumbing.NewTagReferenceName(tag)}, nil
+	}
+
+	if config.Branch != "" {
+		return &deployTarget{RefName: plumbing.NewBranchReferenceName(config.Branch)}, nil
+	}
+
+	return &deployTarget{}, nil
+}
+
+// listRemoteRefs 列出远程仓库的全部引用
+func listRemoteRefs(repoURL string, auth transport.AuthMethod) ([]*plumbing.Reference, error) {
+	return listRemoteRefsPeeled(repoURL, auth, git.IgnorePeeled)
+}
+
+// listRemoteRefsPeeled 列出远程仓库的引用，peeling 决定是否包含附注标签指向的提交（名称以 ^{} 结尾）
+func listRemoteRefsPeeled(repoURL string, auth transport.AuthMethod, peeling git.PeelingOption) ([]*plumbing.Reference, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repoURL},
+	})
+
+	refs, err := remote.List(&git.ListOptions{Auth: auth, PeelingOption: peeling})
+	if err != nil {
+		return nil, fmt.Errorf("列出远程引用失败: %w", err)
+	}
+	return refs, nil
+}
+
+// remoteDefaultBranch 获取远程 HEAD 指向的默认分支
+func remoteDefaultBranch(repoURL string, auth transport.AuthMethod) (plumbing.ReferenceName, error) {
+	refs, err := listRemoteRefs(repoURL, auth)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target(), nil
+		}
+	}
+	return "", fmt.Errorf("无法确定远程默认分支")
+}
+
+// RemoteDefaultBranch 获取站点远程仓库的默认分支名
+func RemoteDefaultBranch(config *config.Site) (string, error) {
+	auth, err := authMethod(config)
+	if err != nil {
+		return "", fmt.Errorf("准备仓库认证失败: %w", err)
+	}
+	name, err := remoteDefaultBranch(config.RepoURL, auth)
+	if err != nil {
+		return "", err
+	}
+	return name.Short(), nil
+}
+
+// latestRemoteTag 列出远程标签，返回匹配模式的最新版本标签
+func latestRemoteTag(repoURL, pattern string, auth transport.AuthMethod) (string, error) {
+	refs, err := listRemoteRefs(repoURL, auth)
+	if err != nil {
+		return "", err
+	}
+	return latestTag(refs, pattern)
+}
+
+// latestTag 从引用列表中选出匹配模式的最新版本标签
+func latestTag(refs []*plumbing.Reference, pattern string) (string, error) {
+	latest := ""
+	for _, ref := range refs {
+		if !ref.Name().IsTag() || strings.HasSuffix(ref.Name().String(), peeledSuffix) {
+			continue
+		}
+		name := ref.Name().Short()
+		if ok, err := path.Match(pattern, name); err != nil {
+			return "", fmt.Errorf("无效的标签模式 %s: %w", pattern, err)
+		} else if !ok {
+			continue
+		}
+		if latest == "" || compareVersions(name, latest) > 0 {
+			latest = name
+		}
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("没有匹配模式 %s 的远程标签", pattern)
+	}
+	return latest, nil
+}
+
+// peeledSuffix 附注标签解引用后的引用名后缀
+const peeledSuffix = "^{}"
+
+// RemoteTargetCommit 只列出远程引用（相当于 git ls-remote），返回部署目标当前指向的提交，不下载任何对象
+// 固定提交直接返回配置的提交，可能为缩写
+func RemoteTargetCommit(config *config.Site) (string, error) {
+	if config.PinnedCommit != "" {
+		return config.PinnedCommit, nil
+	}
+	auth, err := authMethod(config)
+	if err != nil {
+		return "", fmt.Errorf("准备仓库认证失败: %w", err)
+	}
+	refs, err := listRemoteRefsPeeled(config.RepoURL, auth, git.AppendPeeled)
+	if err != nil {
+		return "", err
+	}
+
+	var name plumbing.ReferenceName
+	switch {
+	case config.TagPattern != "":
+		tag, err := latestTag(refs, config.TagPattern)
+		if err != nil {
+			return "", err
+		}
+		name = plumbing.NewTagReferenceName(tag)
+	case config.Branch != "":
+		name = plumbing.NewBranchReferenceName(config.Branch)
+	default:
+		for _, ref := range refs {
+			if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+				name = ref.Target()
+			}
+		}
+		if name == "" {
+			return "", fmt.Errorf("无法确定远程默认分支")
+		}
+	}
+
+	// 附注标签优先使用解引用后的提交
+	var hash string
+	for _, ref := range refs {
+		switch ref.Name() {
+		case name + peeledSuffix:
+			return ref.Hash().String(), nil
+		case name:
+			hash = ref.Hash().String()
+		}
+	}
+	if hash == "" {
+		return "", fmt.Errorf("远程仓库中找不到引用 %s", name)
+	}
+	return hash, nil
+}
+
+// compareVersions 按版本号语义比较两个标签名，数字段按数值比较
+// 一个标签在另一个的基础上带有 - 开头的预发布后缀时（如 v1.0.0-rc1 与 v1.0.0），带后缀的版本较低
+func compareVersions(a, b string) int {
+	as, bs := splitVersion(a), splitVersion(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an > bn {
+					return 1
+				}
+				return -1
+			}
+		case as[i] != bs[i]:
+			if as[i] > bs[i] {
+				return 1
+			}
+			return -1
+		}
+	}
+	switch n := min(len(as), len(bs)); {
+	case len(as) > n && strings.HasPrefix(as[n], "-"):
+		return -1
+	case len(bs) > n && strings.HasPrefix(bs[n], "-"):
+		return 1
+	}
+	return len(as) - len(bs)
+}
+
+// splitVersion 将标签名拆分为数字段与非数字段
+func splitVersion(s string) []string {
+	var parts []string
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || unicode.IsDigit(rune(s[i])) != unicode.IsDigit(rune(s[i-1])) {
+			parts = append(parts, s[start:i])
+			start = i
+		}
+	}
+	return parts
+}
+
+// checkoutTarget 获取远程更新并将工作树强制检出到部署目标
+// 按配置进行浅获取与稀疏检出，固定提交需要完整历史因此忽略 clone_depth
+func checkoutTarget(r *git.Repository, config *config.Site, target *deployTarget, auth transport.AuthMethod) error {
+	depth := config.CloneDepth
+	sparseDirs := config.SparseCheckoutDirs()
+
+	// 显式指定获取范围，不依赖克隆时写入的 refspec（单分支或按标签克隆时范围受限）
+	refSpec := gitconfig.RefSpec("+refs/heads/*:refs/remotes/origin/*")
+	tags := git.AllTags
+	switch {
+	case target.Revision != "":
+		depth = 0
+	case target.RefName.IsBranch():
+		branch := target.RefName.Short()
+		refSpec = gitconfig.RefSpec("+refs/heads/" + branch + ":refs/remotes/origin/" + branch)
+		tags = git.NoTags
+	case target.RefName != "":
+		// 标签或其他引用（如 refs/pull/1/head）原样获取到本地同名引用
+		refSpec = gitconfig.RefSpec("+" + target.RefName.String() + ":" + target.RefName.String())
+		tags = git.NoTags
+	}
+
+	err := r.Fetch(&git.FetchOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{refSpec},
+		Depth:      depth,
+		Auth:       auth,
+		Tags:       tags,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return fmt.Errorf("获取远程更新失败: %w", err)
+	}
+
+	// 分支: 将本地分支更新到远程分支的位置后检出
+	if target.RefName.IsBranch() && target.Revision == "" {
+		remoteRef, err := r.Reference(plumbing.NewRemoteReferenceName("origin", target.RefName.Short()), true)
+		if err != nil {
+			return fmt.Errorf("找不到远程分支 %s: %w", target.RefName.Short(), err)
+		}
+		if err := verifyCommitSignature(r, config, remoteRef.Hash()); err != nil {
+			return err
+		}
+		if err := r.Storer.SetReference(plumbing.NewHashReference(target.RefName, remoteRef.Hash())); err != nil {
+			return fmt.Errorf("更新本地分支失败: %w", err)
+		}
+		return forceCheckout(r, &git.CheckoutOptions{Branch: target.RefName}, sparseDirs)
+	}
+
+	// 标签、其他引用或固定提交: 以分离 HEAD 的方式检出
+	revision := target.Revision
+	if revision == "" {
+		revision = target.RefName.String()
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return fmt.Errorf("无法解析引用 %s: %w", revision, err)
+	}
+	if err := verifyCommitSignature(r, config, *hash); err != nil {
+		return err
+	}
+	return forceCheckout(r, &git.CheckoutOptions{Hash: *hash}, sparseDirs)
+}
+
+// headRefName 返回 HEAD 对应的分支名或指向同一提交的标签名
+func headRefName(r *git.Repository, head *plumbing.Reference) string {
+	if head.Name().IsBranch() {
+		return head.Name().Short()
+	}
+
+	tags, err := r.Tags()
+	if err != nil {
+		return "HEAD"
+	}
+	defer tags.Close()
+
+	name := "HEAD"
+	tags.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := r.TagObject(ref.Hash()); err == nil {
+			target = tag.Target
+		}
+		if target == head.Hash() {
+			name = ref.Name().Short()
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return name
+}
+
+// GetHeadRef 获取仓库当前检出的引用名称与提交哈希
+func GetHeadRef(repoPath string) (string, string, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return "", "", fmt.Errorf("打开仓库失败: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", "", fmt.Errorf("获取 HEAD 失败: %w", err)
+	}
+	return headRefName(r, head), head.Hash().String(), nil
+}
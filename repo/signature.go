@@ -0,0 +1,201 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"git2Web/config"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrUntrustedCommit 提交未签名或签名不受信任
+var ErrUntrustedCommit = errors.New("提交签名验证失败")
+
+// sshSigNamespace git 对提交进行 SSH 签名时使用的命名空间
+const sshSigNamespace = "git"
+
+// verifyCommitSignature 确认提交由受信任的 GPG 或 SSH 密钥签名，未配置签名验证时直接返回
+func verifyCommitSignature(r *git.Repository, config *config.Site, hash plumbing.Hash) error {
+	if config.Signature == nil {
+		return nil
+	}
+	commit, err := r.CommitObject(hash)
+	if err != nil {
+		return fmt.Errorf("读取提交 %s 失败: %w", hash, err)
+	}
+
+	signer, err := checkCommitSignature(commit, config.Signature)
+	if err != nil {
+		log.Printf("拒绝部署提交 %s (%s): %v", hash, commit.Author.Email, err)
+		return fmt.Errorf("%w: 提交 %s: %v", ErrUntrustedCommit, hash, err)
+	}
+	log.Printf("提交 %s 的签名验证通过，签名者: %s", hash, signer)
+	return nil
+}
+
+// checkCommitSignature 按签名类型验证提交，返回签名者描述
+func checkCommitSignature(commit *object.Commit, sig *config.SignatureConfig) (string, error) {
+	signature := strings.TrimSpace(commit.PGPSignature)
+	switch {
+	case signature == "":
+		return "", fmt.Errorf("提交未签名")
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"):
+		if sig.GPGKeyringPath == "" {
+			return "", fmt.Errorf("提交使用 GPG 签名，但未配置 gpg_keyring_path")
+		}
+		keyring, err := os.ReadFile(sig.GPGKeyringPath)
+		if err != nil {
+			return "", fmt.Errorf("读取 GPG 公钥失败: %w", err)
+		}
+		entity, err := commit.Verify(string(keyring))
+		if err != nil {
+			return "", fmt.Errorf("GPG 签名不受信任: %w", err)
+		}
+		for name := range entity.Identities {
+			return name, nil
+		}
+		return entity.PrimaryKey.KeyIdString(), nil
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		if sig.SSHAllowedSignersPath == "" {
+			return "", fmt.Errorf("提交使用 SSH 签名，但未配置 ssh_allowed_signers_path")
+		}
+		payload, err := commitPayload(commit)
+		if err != nil {
+			return "", err
+		}
+		return verifySSHSignature(signature, payload, sig.SSHAllowedSignersPath)
+	}
+	return "", fmt.Errorf("不支持的签名类型")
+}
+
+// commitPayload 返回提交去掉签名后的原始内容，即签名时的数据
+func commitPayload(commit *object.Commit) ([]byte, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		return nil, fmt.Errorf("编码提交失败: %w", err)
+	}
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// sshSignature SSH 签名（sshsig 格式）的内容
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// verifySSHSignature 按 sshsig 格式验证签名，并确认公钥在受信任列表中
+func verifySSHSignature(armored string, payload []byte, allowedPath string) (string, error) {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != "SSH SIGNATURE" {
+		return "", fmt.Errorf("无法解析 SSH 签名")
+	}
+	blob := block.Bytes
+	if !bytes.HasPrefix(blob, []byte("SSHSIG")) {
+		return "", fmt.Errorf("SSH 签名格式无效")
+	}
+	var s sshSignature
+	if err := ssh.Unmarshal(blob[6:], &s); err != nil {
+		return "", fmt.Errorf("SSH 签名格式无效: %w", err)
+	}
+	if s.Version != 1 {
+		return "", fmt.Errorf("不支持的 SSH 签名版本 %d", s.Version)
+	}
+	if s.Namespace != sshSigNamespace {
+		return "", fmt.Errorf("SSH 签名的命名空间为 %q，期望 %q", s.Namespace, sshSigNamespace)
+	}
+
+	pub, err := ssh.ParsePublicKey(s.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("解析签名公钥失败: %w", err)
+	}
+	principal, err := findAllowedSigner(allowedPath, pub)
+	if err != nil {
+		return "", err
+	}
+
+	var h hash.Hash
+	switch s.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("不支持的签名哈希算法 %s", s.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(s.Signature, &sig); err != nil {
+		return "", fmt.Errorf("SSH 签名格式无效: %w", err)
+	}
+	signed := ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{s.Namespace, s.Reserved, s.HashAlgorithm, h.Sum(nil)})
+	if err := pub.Verify(append([]byte("SSHSIG"), signed...), &sig); err != nil {
+		return "", fmt.Errorf("SSH 签名无效: %w", err)
+	}
+	return principal, nil
+}
+
+// findAllowedSigner 在受信任列表中查找公钥，返回对应的签名者
+// 文件格式兼容 git 的 allowed_signers（principal [options] keytype key）与 authorized_keys
+func findAllowedSigner(path string, pub ssh.PublicKey) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("读取受信任的 SSH 公钥失败: %w", err)
+	}
+	defer file.Close()
+
+	want := pub.Marshal()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i, field := range fields {
+			if !strings.HasPrefix(field, "ssh-") && !strings.HasPrefix(field, "ecdsa-") && !strings.HasPrefix(field, "sk-") {
+				continue
+			}
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.Join(fields[i:], " ")))
+			if err != nil || !bytes.Equal(key.Marshal(), want) {
+				break
+			}
+			if i > 0 {
+				return fields[0], nil
+			}
+			return ssh.FingerprintSHA256(key), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("读取受信任的 SSH 公钥失败: %w", err)
+	}
+	return "", fmt.Errorf("签名公钥 %s 不在受信任列表中", ssh.FingerprintSHA256(pub))
+}
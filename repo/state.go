@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// RepoState 仓库当前检出的版本
+type RepoState struct {
+	Commit      string    `json:"commit"`
+	Ref         string    `json:"ref"`
+	Detached    bool      `json:"detached"`
+	Message     string    `json:"message"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"author_email"`
+	CommitTime  time.Time `json:"commit_time"`
+}
+
+// GetRepoState 读取仓库当前检出的提交信息，Message 只保留提交说明的第一行
+func GetRepoState(repoPath string) (*RepoState, error) {
+	r, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开仓库失败: %w", err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("获取 HEAD 失败: %w", err)
+	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("获取提交对象失败: %w", err)
+	}
+
+	message, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	return &RepoState{
+		Commit:      head.Hash().String(),
+		Ref:         headRefName(r, head),
+		Detached:    !head.Name().IsBranch(),
+		Message:     message,
+		Author:      commit.Author.Name,
+		AuthorEmail: commit.Author.Email,
+		CommitTime:  commit.Committer.When,
+	}, nil
+}
+
+// GetBranchInfo 读取仓库当前检出的版本并输出到日志，出错时只记录日志并返回错误
+func GetBranchInfo(repoPath string) (*RepoState, error) {
+	state, err := GetRepoState(repoPath)
+	if err != nil {
+		log.Printf("读取仓库状态失败: %v", err)
+		return nil, err
+	}
+
+	log.Printf("当前 HEAD Commit: %s", state.Commit)
+	if state.Detached {
+		log.Printf("当前是一个分离的 HEAD 状态 (Detached HEAD)，对应引用: %s", state.Ref)
+	} else {
+		log.Printf("当前分支: %s", state.Ref)
+	}
+	log.Printf("当前的提交信息: %s (%s, %s)", state.Message, state.Author, state.CommitTime.Format(time.RFC3339))
+	return state, nil
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"fmt"
+	"log"
+	"path"
+
+	"git2Web/config"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// updateSubmodules 递归初始化并更新子模块，depth 为剩余的递归层数
+// offline 为 true 时只使用本地已有的对象，用于回滚
+func updateSubmodules(r *git.Repository, config *config.Site, parentURL string, depth int, offline bool) error {
+	if depth <= 0 {
+		return nil
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("获取工作树失败: %w", err)
+	}
+	subs, err := w.Submodules()
+	if err != nil {
+		return fmt.Errorf("读取子模块失败: %w", err)
+	}
+
+	sparseDirs := config.SparseCheckoutDirs()
+	for _, sub := range subs {
+		// 稀疏检出时跳过不在发布目录中的子模块（仅对主仓库生效）
+		if len(sparseDirs) > 0 && parentURL == config.RepoURL && !inSparseDirs(sub.Config().Path, sparseDirs) {
+			continue
+		}
+
+		subURL := resolveSubmoduleURL(parentURL, sub.Config().URL)
+		auth, err := submoduleAuth(config, subURL)
+		if err != nil {
+			return fmt.Errorf("准备子模块 %s 的认证失败: %w", sub.Config().Name, err)
+		}
+
+		log.Printf("更新子模块: %s (%s)", sub.Config().Path, subURL)
+		err = sub.Update(&git.SubmoduleUpdateOptions{
+			Init:    true,
+			NoFetch: offline,
+			Auth:    auth,
+			Depth:   config.CloneDepth,
+		})
+		if err != nil {
+			return fmt.Errorf("更新子模块 %s 失败: %w", sub.Config().Name, err)
+		}
+
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("打开子模块 %s 失败: %w", sub.Config().Name, err)
+		}
+		if err := updateSubmodules(subRepo, config, subURL, depth-1, offline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSubmoduleURL 将相对路径形式的子模块地址（如 ../theme.git）解析为完整地址
+func resolveSubmoduleURL(parentURL, subURL string) string {
+	sub, err := transport.NewEndpoint(subURL)
+	if err != nil || sub.Protocol != "file" || path.IsAbs(sub.Path) {
+		return subURL
+	}
+	parent, err := transport.NewEndpoint(parentURL)
+	if err != nil {
+		return subURL
+	}
+	parent.Path = path.Join(parent.Path, sub.Path)
+	return parent.String()
+}
+
+// submoduleAuth 选择子模块使用的认证: 优先使用按主机配置的认证，
+// 与主仓库同主机时沿用主仓库认证，其他主机不发送凭据
+func submoduleAuth(config *config.Site, subURL string) (transport.AuthMethod, error) {
+	sub, err := transport.NewEndpoint(subURL)
+	if err != nil {
+		return nil, err
+	}
+	if auth, ok := config.SubmoduleAuth[sub.Host]; ok {
+		return authMethodFor(subURL, auth)
+	}
+	if main, err := transport.NewEndpoint(config.RepoURL); err == nil && main.Host == sub.Host {
+		return authMethodFor(subURL, config.RepoAuth)
+	}
+	return nil, nil
+}
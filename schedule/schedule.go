@@ -0,0 +1,41 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// MinInterval 轮询的最小间隔，避免频繁访问远程仓库
+const MinInterval = 10 * time.Second
+
+// Schedule 计算下一次触发时间
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Every 固定间隔触发
+type Every time.Duration
+
+// Next 返回 t 之后一个间隔的时间
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// Parse 根据间隔（如 5m）或 cron 表达式创建调度，两者都为空时返回 nil
+// 同时配置时 cron 表达式优先
+func Parse(interval, cron string) (Schedule, error) {
+	if cron != "" {
+		return ParseCron(cron)
+	}
+	if interval == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return nil, fmt.Errorf("轮询间隔 %q 无效: %w", interval, err)
+	}
+	if d < MinInterval {
+		return nil, fmt.Errorf("轮询间隔 %s 小于最小间隔 %s", d, MinInterval)
+	}
+	return Every(d), nil
+}
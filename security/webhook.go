@@ -1,12 +1,15 @@
 package security
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"io"
 	"log"
 	"net/http"
+	"strings"
 )
 
 // ValidateWebhook 验证来自 GitHub/GitLab 的 Webhook 请求
@@ -35,7 +38,7 @@ func ValidateWebhook(r *http.Request, secret string) bool {
 			return false
 		}
 		// 重置 body，以便后续处理可以再次读取
-		r.Body = io.NopCloser(io.MultiReader(io.NopCloser(io.MultiReader()), io.NopCloser(io.MultiReader())))
+		r.Body = io.NopCloser(bytes.NewReader(body))
 
 		// 计算 HMAC
 		mac := hmac.New(sha256.New, []byte(secret))
@@ -48,3 +51,23 @@ func ValidateWebhook(r *http.Request, secret string) bool {
 	// 对于 GitLab，直接比较 token
 	return signature == secret
 }
+
+// ValidateToken 验证管理接口请求携带的令牌
+// 支持 Authorization: Bearer <token> 与 X-Git2Web-Token 两种方式
+func ValidateToken(r *http.Request, token string) bool {
+	if token == "" {
+		// 如果未配置令牌，则不进行验证
+		return true
+	}
+
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if provided == "" {
+		provided = r.Header.Get("X-Git2Web-Token")
+	}
+	if provided == "" {
+		log.Println("警告: 管理接口请求未携带令牌")
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
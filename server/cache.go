@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"git2Web/repo"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// cacheControl 返回文件适用的 Cache-Control，没有匹配的规则时返回空
+func (s *fileServer) cacheControl(name string) string {
+	urlPath := path.Join(s.prefix, name)
+	for _, rule := range s.serve.CacheRules {
+		if matchPathGlob(rule.Path, urlPath) {
+			return rule.CacheControl
+		}
+	}
+	return ""
+}
+
+// matchPathGlob 判断 URL 路径是否匹配模式，* 匹配一级，** 匹配任意多级，不含 / 的模式匹配文件名
+func matchPathGlob(pattern, urlPath string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(urlPath))
+		return ok
+	}
+	return matchSegments(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(strings.Trim(urlPath, "/"), "/"))
+}
+
+// matchSegments 逐级匹配路径
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// maxBlobHashSize 计算 ETag 时读取的未跟踪文件的大小上限，超出的文件不设置 ETag
+const maxBlobHashSize = 32 << 20
+
+// trackedFiles 返回分区暂存区中的文件，首次调用时读取，不是 git 仓库时返回空
+func (s *fileServer) trackedFiles() map[string]repo.TrackedFile {
+	s.trackedOnce.Do(func() {
+		files, err := repo.TrackedFiles(s.repoPath)
+		if err != nil {
+			log.Printf("读取分区 %s 的暂存区失败，文件哈希将按内容计算: %v", s.repoPath, err)
+			return
+		}
+		s.tracked = files
+	})
+	return s.tracked
+}
+
+// blobHash 返回文件内容的 git 对象哈希，内容不变时重新部署也保持不变
+// 检出后未修改的文件直接使用暂存区中的哈希；构建输出等其他文件读取内容计算，超过大小上限时返回空
+// 按部署缓存，读取失败时返回空；读取后将文件位置恢复到开头
+func (s *fileServer) blobHash(name string, stat os.FileInfo, f http.File) string {
+	key := fmt.Sprintf("%s:%d:%d", name, stat.Size(), stat.ModTime().UnixNano())
+	if cached, ok := s.blobHashes.Load(key); ok {
+		return cached.(string)
+	}
+
+	if rel, err := filepath.Rel(s.repoPath, s.localPath(name)); err == nil {
+		tracked, ok := s.trackedFiles()[filepath.ToSlash(rel)]
+		if ok && tracked.Size == stat.Size() && tracked.ModTime.Equal(stat.ModTime()) {
+			s.blobHashes.Store(key, tracked.Hash)
+			return tracked.Hash
+		}
+	}
+	if stat.Size() > maxBlobHashSize {
+		return ""
+	}
+
+	hasher := plumbing.NewHasher(plumbing.BlobObject, stat.Size())
+	_, err := io.Copy(hasher, f)
+	if _, seekErr := f.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	if err != nil {
+		log.Printf("计算文件 %s 的哈希失败: %v", name, err)
+		return ""
+	}
+	hash := hasher.Sum().String()
+	s.blobHashes.Store(key, hash)
+	return hash
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// minCompressSize 小于该大小的文件压缩后收益很小，不进行压缩
+	minCompressSize = 1024
+	// maxCompressSize 大于该大小的文件不在内存中压缩，仍可使用预先压缩的文件
+	maxCompressSize = 16 << 20
+	// maxCompressCacheSize 每个部署缓存的压缩内容总大小上限，缓存已满时未缓存的文件不再即时压缩
+	maxCompressCacheSize = 64 << 20
+)
+
+// contentEncoding 支持的内容编码，按优先级排列
+type contentEncoding struct {
+	name string
+	// ext 预先压缩的文件的后缀
+	ext      string
+	compress func(w io.Writer) io.WriteCloser
+}
+
+var contentEncodings = []contentEncoding{
+	{name: "br", ext: ".br", compress: func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	}},
+	{name: "gzip", ext: ".gz", compress: func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	}},
+}
+
+// compressibleTypes 可以压缩的非 text/* 类型，图片、视频与压缩包等已压缩的格式不在其中
+var compressibleTypes = map[string]bool{
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"application/wasm":          true,
+	"application/xml":           true,
+	"application/xhtml+xml":     true,
+	"application/rss+xml":       true,
+	"application/atom+xml":      true,
+	"application/ld+json":       true,
+	"image/svg+xml":             true,
+	"image/x-icon":              true,
+	"font/ttf":                  true,
+	"font/otf":                  true,
+}
+
+// compressCache 部署中文件的压缩内容，随处理器一起在切换分区时替换
+type compressCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	size    int64
+}
+
+// serveCompressed 按请求的 Accept-Encoding 返回压缩的内容，已处理请求时返回 true
+// 优先使用仓库中预先压缩的 .br/.gz 文件，没有时对可压缩的类型即时压缩并缓存；hash 为原文件的 git 对象哈希
+func (s *fileServer) serveCompressed(w http.ResponseWriter, r *http.Request, name string, stat os.FileInfo, f http.File, hash string) bool {
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		return false
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	// 范围请求返回未压缩的内容，避免对压缩后的内容取范围
+	if r.Header.Get("Range") != "" {
+		return false
+	}
+	accept := r.Header.Get("Accept-Encoding")
+
+	for _, enc := range contentEncodings {
+		if !acceptsEncoding(accept, enc.name) {
+			continue
+		}
+		sibling, err := s.fs.Open(name + enc.ext)
+		if err != nil {
+			continue
+		}
+		defer sibling.Close()
+		siblingStat, err := sibling.Stat()
+		if err != nil || siblingStat.IsDir() {
+			continue
+		}
+		setEncodingHeaders(w, ctype, enc.name, siblingStat.Size())
+		if siblingHash := s.blobHash(name+enc.ext, siblingStat, sibling); siblingHash != "" {
+			w.Header().Set("ETag", `"`+siblingHash+`"`)
+		}
+		http.ServeContent(w, r, stat.Name(), siblingStat.ModTime(), sibling)
+		return true
+	}
+
+	if !compressibleType(ctype) || stat.Size() < minCompressSize || stat.Size() > maxCompressSize {
+		return false
+	}
+	for _, enc := range contentEncodings {
+		if !acceptsEncoding(accept, enc.name) {
+			continue
+		}
+		data, err := s.compressed(name, stat, f, enc)
+		if err != nil {
+			log.Printf("压缩文件 %s 失败: %v", name, err)
+			return false
+		}
+		// 缓存已满，返回未压缩的内容，避免每次请求都重新压缩
+		if data == nil {
+			return false
+		}
+		setEncodingHeaders(w, ctype, enc.name, int64(len(data)))
+		// 压缩结果由原文件决定，与未压缩的内容使用不同的 ETag
+		if hash != "" {
+			w.Header().Set("ETag", `"`+hash+"-"+enc.name+`"`)
+		}
+		http.ServeContent(w, r, stat.Name(), stat.ModTime(), bytes.NewReader(data))
+		return true
+	}
+	return false
+}
+
+// compressed 返回文件压缩后的内容，优先从缓存读取；缓存没有空间容纳时不压缩，返回 nil
+// 压缩前按原文件大小预留缓存空间，并发压缩的文件不会超出上限
+func (s *fileServer) compressed(name string, stat os.FileInfo, f http.File, enc contentEncoding) ([]byte, error) {
+	key := fmt.Sprintf("%s:%s:%d:%d", enc.name, name, stat.Size(), stat.ModTime().UnixNano())
+	c := &s.compressCache
+	c.mu.Lock()
+	if data, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		return data, nil
+	}
+	if c.size+stat.Size() > maxCompressCacheSize {
+		c.mu.Unlock()
+		return nil, nil
+	}
+	c.size += stat.Size()
+	c.mu.Unlock()
+
+	data, err := compressFile(f, enc)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size -= stat.Size()
+	if err != nil {
+		return nil, err
+	}
+	// 并发的请求已经缓存了同一文件
+	if cached, ok := c.entries[key]; ok {
+		return cached, nil
+	}
+	if c.entries == nil {
+		c.entries = make(map[string][]byte)
+	}
+	c.entries[key] = data
+	c.size += int64(len(data))
+	return data, nil
+}
+
+// compressFile 按编码压缩文件的全部内容
+func compressFile(f io.Reader, enc contentEncoding) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := enc.compress(&buf)
+	if _, err := io.Copy(zw, f); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// setEncodingHeaders 设置压缩内容的响应头
+// Content-Type 按原文件设置，避免按压缩后的内容推断；设置了 Content-Encoding 时 http.ServeContent 不设置 Content-Length
+func setEncodingHeaders(w http.ResponseWriter, ctype, encoding string, size int64) {
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Set("Content-Encoding", encoding)
+	h.Set("Content-Length", strconv.FormatInt(size, 10))
+}
+
+// compressibleType 判断 MIME 类型是否值得压缩
+func compressibleType(ctype string) bool {
+	mediaType, _, _ := strings.Cut(ctype, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// acceptsEncoding 判断 Accept-Encoding 是否接受指定的编码，q=0 表示不接受
+func acceptsEncoding(header, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encoding && name != "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		// 明确列出的编码优先于 *
+		if name == encoding {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"git2Web/build"
+	"git2Web/config"
+	"git2Web/history"
+	"git2Web/repo"
+	"git2Web/security"
+)
+
+// siteMutexes 每个站点一把锁，保证同一站点的更新与回滚操作串行执行
+var siteMutexes sync.Map
+
+// lockSite 锁定站点，返回解锁函数
+func lockSite(site *config.Site) func() {
+	mu, _ := siteMutexes.LoadOrStore(site, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// RecordDeployment 记录站点活动分区当前部署的提交并保存配置
+func RecordDeployment(config *config.Config, site *config.Site, configPath string) {
+	ref, commit, err := repo.GetHeadRef(site.GetActiveTargetPath())
+	if err != nil {
+		// 上传的构建产物没有仓库，沿用上传时的记录
+		if site.Partitions[site.ActivePartition].Version == "" {
+			log.Printf("[%s] 读取部署提交失败: %v", site.Label(), err)
+		}
+		return
+	}
+	site.RecordDeployment(site.ActivePartition, ref, commit)
+	if err := config.SaveConfig(configPath); err != nil {
+		log.Printf("保存配置文件失败: %v", err)
+	}
+}
+
+// deploySite 执行一次更新并记录到部署历史，trigger 为触发来源
+func deploySite(cfg *config.Config, site *config.Site, configPath, trigger string) error {
+	start := time.Now()
+	partition, err := updateSite(cfg, site, configPath)
+	RecordHistory(site, trigger, start, partition, err)
+	return err
+}
+
+// updateSite 将站点更新到最新的部署目标，返回部署或尝试部署新版本的分区（未获取到新版本时为空）
+// AB 分区模式下在非激活分区中获取更新、构建并检查，全部成功后才切换活动分区，失败时当前版本继续提供服务；
+// 直接拉取模式下在活动分区中拉取更新
+func updateSite(cfg *config.Config, site *config.Site, configPath string) (string, error) {
+	if site.UploadOnly() {
+		return "", fmt.Errorf("站点未配置 repo_url，只能通过上传部署")
+	}
+	if !site.UsePartitions() {
+		if err := repo.PullRepo(site); err != nil {
+			return "", fmt.Errorf("拉取仓库时出错: %w", err)
+		}
+		RecordDeployment(cfg, site, configPath)
+		ReloadStaticSite(site)
+		return site.ActivePartition, nil
+	}
+
+	log.Println("使用 AB 分区策略更新仓库")
+	inactivePartition := site.GetInactivePartition()
+	inactivePath := site.GetInactiveTargetPath()
+
+	// 增量更新非激活分区，复用已有对象与活动分区中的对象
+	log.Printf("开始增量更新非激活分区: %s", inactivePath)
+	if err := repo.SyncPartition(site, inactivePath, site.GetActiveTargetPath()); err != nil {
+		return "", fmt.Errorf("更新非激活分区失败: %w", err)
+	}
+	if err := BuildPartition(cfg, site, inactivePath, configPath); err != nil {
+		return inactivePartition, err
+	}
+	if err := verifyPartition(site, inactivePath); err != nil {
+		return inactivePartition, err
+	}
+
+	// 切换活动分区
+	log.Println("切换活动分区")
+	site.SwitchActivePartition()
+
+	// 记录部署并保存配置更改，保存失败不阻止服务切换
+	RecordDeployment(cfg, site, configPath)
+
+	// 将静态文件服务切换到新分区
+	log.Println("切换静态文件服务到新分区")
+	ReloadStaticSite(site)
+	return inactivePartition, nil
+}
+
+// BuildPartition 在分区中执行站点的构建步骤并记录结果，未配置构建时直接返回
+func BuildPartition(cfg *config.Config, site *config.Site, partitionPath, configPath string) error {
+	if !site.HasBuild() {
+		return nil
+	}
+	_, commit, err := repo.GetHeadRef(partitionPath)
+	if err != nil {
+		return fmt.Errorf("读取分区提交失败: %w", err)
+	}
+
+	log.Printf("[%s] 开始构建分区: %s", site.Label(), partitionPath)
+	info, err := build.Run(site, partitionPath, commit)
+	site.RecordBuild(info)
+	if err := cfg.SaveConfig(configPath); err != nil {
+		log.Printf("保存配置文件失败: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("构建失败: %w\n%s", err, info.Output)
+	}
+	return nil
+}
+
+// rollback 不访问网络回滚站点的部署
+// AB 分区模式下切换回保留着上一个部署的非激活分区，commit 非空或分区已被失败的更新覆盖时先在非激活分区检出提交；
+// 直接拉取模式下在活动分区检出 commit，未指定时检出上一次部署的提交
+func rollback(cfg *config.Config, site *config.Site, configPath, commit string) (*config.RollbackInfo, error) {
+	activePath := site.GetActiveTargetPath()
+	from := site.Partitions[site.ActivePartition]
+	info := &config.RollbackInfo{
+		From:          from.Commit,
+		FromPartition: site.ActivePartition,
+		At:            time.Now(),
+	}
+
+	if site.UsePartitions() {
+		inactivePartition := site.GetInactivePartition()
+		inactivePath := site.GetInactiveTargetPath()
+
+		if commit == "" {
+			prev, ok := site.Partitions[inactivePartition]
+			if !ok || (prev.Commit == "" && prev.Version == "") {
+				return nil, fmt.Errorf("非激活分区 %s 没有可回滚的部署记录", inactivePartition)
+			}
+			if prev.Commit == "" {
+				// 上传的构建产物没有提交，无法重新检出，只能确认目录仍在且没有被 Git 更新覆盖
+				if _, err := os.Stat(inactivePath); err != nil {
+					return nil, fmt.Errorf("非激活分区 %s 已不存在", inactivePartition)
+				}
+				if _, _, err := repo.GetHeadRef(inactivePath); err == nil {
+					return nil, fmt.Errorf("非激活分区 %s 中上传的版本 %s 已被之后的更新覆盖", inactivePartition, prev.Version)
+				}
+			} else if _, head, err := repo.GetHeadRef(inactivePath); err != nil || head != prev.Commit {
+				// 失败的更新同样在非激活分区中进行，会覆盖上一个部署，从本地对象重新检出记录的提交
+				log.Printf("[%s] 非激活分区 %s 已不是记录的提交 %s，重新检出", site.Label(), inactivePartition, prev.Commit)
+				commit = prev.Commit
+			}
+		}
+
+		if commit != "" {
+			if err := repo.CheckoutCommit(site, inactivePath, commit, activePath); err != nil {
+				return nil, err
+			}
+			// 检出会清理之前的构建输出，需要重新构建
+			if err := BuildPartition(cfg, site, inactivePath, configPath); err != nil {
+				return nil, err
+			}
+			if err := verifyPartition(site, inactivePath); err != nil {
+				return nil, err
+			}
+		}
+
+		log.Printf("[%s] 回滚: 切换活动分区 %s -> %s", site.Label(), site.ActivePartition, inactivePartition)
+		site.SwitchActivePartition()
+		RecordDeployment(cfg, site, configPath)
+		ReloadStaticSite(site)
+	} else {
+		if commit == "" {
+			commit = from.PreviousCommit
+		}
+		if commit == "" {
+			return nil, fmt.Errorf("没有可回滚的上一次部署记录")
+		}
+		if err := repo.CheckoutCommit(site, activePath, commit, ""); err != nil {
+			return nil, err
+		}
+		RecordDeployment(cfg, site, configPath)
+		ReloadStaticSite(site)
+	}
+
+	info.To = site.Partitions[site.ActivePartition].Commit
+	info.ToPartition = site.ActivePartition
+	site.RecordRollback(info)
+	if err := cfg.SaveConfig(configPath); err != nil {
+		log.Printf("保存配置文件失败: %v", err)
+	}
+	log.Printf("[%s] 回滚完成: 分区 %s 提交 %s -> 分区 %s 提交 %s",
+		site.Label(), info.FromPartition, info.From, info.ToPartition, info.To)
+	return info, nil
+}
+
+// authorizeAdmin 验证会修改线上内容的管理接口请求，验证失败时写入错误响应并返回 false
+// 未配置管理令牌时拒绝所有请求，避免任何人都能替换或回滚站点
+func authorizeAdmin(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		http.Error(w, "未配置 admin_token，接口已禁用", http.StatusForbidden)
+		return false
+	}
+	if !security.ValidateToken(r, token) {
+		http.Error(w, "未授权的请求", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// rollbackHandler 回滚接口，POST /rollback[?site=<name>][&commit=<hash>]
+// 只有一个站点时可省略 site
+func rollbackHandler(config *config.Config, configPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("\n----------\n收到回滚请求")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "仅支持 POST 请求", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeAdmin(w, r, config.GetAdminToken()) {
+			log.Println("回滚请求验证失败")
+			return
+		}
+
+		site := config.FindSite(r.URL.Query().Get("site"))
+		if site == nil {
+			http.Error(w, "未找到站点", http.StatusNotFound)
+			return
+		}
+
+		// 回滚可能需要重新构建，耗时超过服务器的写入超时
+		clearWriteDeadline(w)
+		unlock := lockSite(site)
+		defer unlock()
+
+		start := time.Now()
+		info, err := rollback(config, site, configPath, r.URL.Query().Get("commit"))
+		partition := ""
+		if info != nil {
+			partition = info.ToPartition
+		}
+		RecordHistory(site, history.TriggerRollback, start, partition, err)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("回滚失败: %v", err), http.StatusConflict)
+			log.Printf("回滚失败: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxWebhookBody 读取的 Webhook 请求体上限
+const maxWebhookBody = 10 << 20
+
+// pushEvent 推送事件中与部署相关的信息
+type pushEvent struct {
+	// Branch 推送的分支，推送标签时为空
+	Branch string
+	// Deleted 分支是否被删除
+	Deleted bool
+}
+
+// parsePushEvent 解析 GitHub、Gitea 与 GitLab 的推送事件，不是推送事件或无法解析时返回 nil
+func parsePushEvent(r *http.Request, body []byte) *pushEvent {
+	for _, header := range []string{"X-GitHub-Event", "X-Gitea-Event"} {
+		if event := r.Header.Get(header); event != "" && event != "push" {
+			return nil
+		}
+	}
+	if event := r.Header.Get("X-Gitlab-Event"); event != "" && event != "Push Hook" {
+		return nil
+	}
+
+	var payload struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Deleted bool   `json:"deleted"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Ref == "" {
+		return nil
+	}
+
+	event := &pushEvent{
+		Branch: strings.TrimPrefix(payload.Ref, "refs/heads/"),
+		// GitLab 与 Gitea 删除分支时 after 为全零
+		Deleted: payload.Deleted || (payload.After != "" && strings.Trim(payload.After, "0") == ""),
+	}
+	if event.Branch == payload.Ref {
+		event.Branch = ""
+	}
+	return event
+}
+
+// pullRequestEvent 合并请求事件中与预览相关的信息
+type pullRequestEvent struct {
+	Number int
+	Title  string
+	// Branch 合并请求的源分支
+	Branch string
+	// Ref 合并请求在目标仓库中的头引用，来自派生仓库的合并请求也可以获取
+	Ref string
+	// Closed 合并请求已关闭或已合并，需要删除预览；否则需要部署预览
+	Closed bool
+	// Fork 合并请求来自派生仓库，源仓库无法确定时同样视为派生仓库
+	Fork bool
+	// HeadURLs 源仓库的克隆与网页地址
+	HeadURLs []string
+}
+
+// fromRepo 判断合并请求的源仓库是否为 repoURL，HTTPS 与 SSH 地址视为相同
+func (e *pullRequestEvent) fromRepo(repoURL string) bool {
+	want := normalizeRepoURL(repoURL)
+	for _, u := range e.HeadURLs {
+		if want != "" && normalizeRepoURL(u) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRepoURL 将仓库地址规范为 host/path，去掉协议、用户、端口与 .git 后缀
+func normalizeRepoURL(repoURL string) string {
+	s := strings.TrimSpace(repoURL)
+	if s == "" {
+		return ""
+	}
+	if !strings.Contains(s, "://") {
+		// git@host:org/repo 形式的 SSH 地址
+		if host, p, ok := strings.Cut(s, ":"); ok {
+			s = "ssh://" + host + "/" + p
+		}
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	p := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	return strings.ToLower(u.Hostname() + "/" + p)
+}
+
+// eventRepo 合并请求事件中的仓库
+type eventRepo struct {
+	ID       int64  `json:"id"`
+	FullName string `json:"full_name"`
+	CloneURL string `json:"clone_url"`
+	SSHURL   string `json:"ssh_url"`
+	HTMLURL  string `json:"html_url"`
+}
+
+// urls 返回仓库的克隆与网页地址，仓库为空时返回 nil
+func (r *eventRepo) urls() []string {
+	if r == nil {
+		return nil
+	}
+	return []string{r.CloneURL, r.SSHURL, r.HTMLURL}
+}
+
+// same 判断两个仓库是否为同一个，任一为空时返回 false
+func (r *eventRepo) same(other *eventRepo) bool {
+	if r == nil || other == nil {
+		return false
+	}
+	if r.ID != 0 && other.ID != 0 {
+		return r.ID == other.ID
+	}
+	return r.FullName != "" && strings.EqualFold(r.FullName, other.FullName)
+}
+
+// parsePullRequestEvent 解析 GitHub、Gitea 的 pull_request 事件与 GitLab 的 Merge Request Hook 事件
+// 只返回需要部署或删除预览的动作（打开、重新打开、推送新提交、关闭），其他事件返回 nil
+func parsePullRequestEvent(r *http.Request, body []byte) *pullRequestEvent {
+	if r.Header.Get("X-Gitlab-Event") == "Merge Request Hook" {
+		return parseGitLabMergeRequest(body)
+	}
+	event := r.Header.Get("X-Gitea-Event")
+	if event == "" {
+		event = r.Header.Get("X-GitHub-Event")
+	}
+	if event != "pull_request" {
+		return nil
+	}
+
+	var payload struct {
+		Action      string `json:"action"`
+		Number      int    `json:"number"`
+		PullRequest struct {
+			Title string `json:"title"`
+			Head  struct {
+				Ref  string     `json:"ref"`
+				Repo *eventRepo `json:"repo"`
+			} `json:"head"`
+			Base struct {
+				Repo *eventRepo `json:"repo"`
+			} `json:"base"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Number <= 0 {
+		return nil
+	}
+
+	e := &pullRequestEvent{
+		Number: payload.Number,
+		Title:  payload.PullRequest.Title,
+		Branch: payload.PullRequest.Head.Ref,
+		Ref:    fmt.Sprintf("refs/pull/%d/head", payload.Number),
+		// 派生仓库被删除时 head.repo 为 null
+		Fork:     !payload.PullRequest.Head.Repo.same(payload.PullRequest.Base.Repo),
+		HeadURLs: payload.PullRequest.Head.Repo.urls(),
+	}
+	switch payload.Action {
+	// Gitea 推送新提交时为 synchronized
+	case "opened", "reopened", "synchronize", "synchronized":
+	case "closed":
+		e.Closed = true
+	default:
+		return nil
+	}
+	return e
+}
+
+// parseGitLabMergeRequest 解析 GitLab 的合并请求事件
+func parseGitLabMergeRequest(body []byte) *pullRequestEvent {
+	var payload struct {
+		ObjectAttributes struct {
+			IID             int    `json:"iid"`
+			Title           string `json:"title"`
+			SourceBranch    string `json:"source_branch"`
+			Action          string `json:"action"`
+			SourceProjectID int64  `json:"source_project_id"`
+			TargetProjectID int64  `json:"target_project_id"`
+			Source          struct {
+				GitHTTPURL string `json:"git_http_url"`
+				GitSSHURL  string `json:"git_ssh_url"`
+				WebURL     string `json:"web_url"`
+			} `json:"source"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.ObjectAttributes.IID <= 0 {
+		return nil
+	}
+
+	attrs := payload.ObjectAttributes
+	e := &pullRequestEvent{
+		Number:   attrs.IID,
+		Title:    attrs.Title,
+		Branch:   attrs.SourceBranch,
+		Ref:      fmt.Sprintf("refs/merge-requests/%d/head", attrs.IID),
+		Fork:     attrs.SourceProjectID == 0 || attrs.SourceProjectID != attrs.TargetProjectID,
+		HeadURLs: []string{attrs.Source.GitHTTPURL, attrs.Source.GitSSHURL, attrs.Source.WebURL},
+	}
+	switch attrs.Action {
+	case "open", "reopen", "update":
+	case "close", "merge":
+		e.Closed = true
+	default:
+		return nil
+	}
+	return e
+}
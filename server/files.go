@@ -0,0 +1,257 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"git2Web/config"
+	"git2Web/repo"
+)
+
+// fileServer 一个目录的静态文件处理器，支持单页应用回退、自定义错误页面、简洁 URL、自定义索引文件、目录列表方式、压缩与缓存规则
+type fileServer struct {
+	dir string
+	// repoPath 目录所在分区的仓库，用于读取目录列表中的修改时间
+	repoPath string
+	// prefix 目录挂载的 URL 前缀，用于匹配缓存规则
+	prefix string
+	fs     http.FileSystem
+	// files 用于列出没有索引文件的目录
+	files http.Handler
+	serve *config.ServeConfig
+	// errorPages 各状态码的错误页面内容，创建时读取，分区切换时随处理器一起替换
+	errorPages map[int][]byte
+	// listingTimes 各目录中条目的提交时间，列出目录时读取
+	listingTimes sync.Map
+	// compressCache 即时压缩的内容
+	compressCache compressCache
+	// blobHashes 各文件的 git 对象哈希，用作 ETag
+	blobHashes sync.Map
+	// tracked 分区暂存区中的文件，计算 ETag 时读取
+	tracked     map[string]repo.TrackedFile
+	trackedOnce sync.Once
+}
+
+// newFileServer 创建目录的静态文件处理器，repoPath 为目录所在的分区，prefix 为挂载的 URL 前缀
+func newFileServer(dir, repoPath, prefix string, serve *config.ServeConfig) *fileServer {
+	if serve == nil {
+		serve = &config.ServeConfig{}
+	}
+	fs := http.Dir(dir)
+	s := &fileServer{
+		dir:        dir,
+		repoPath:   repoPath,
+		prefix:     prefix,
+		fs:         fs,
+		files:      http.FileServer(fs),
+		serve:      serve,
+		errorPages: make(map[int][]byte),
+	}
+
+	pages := map[int]string{http.StatusNotFound: "404.html"}
+	for code, name := range serve.ErrorPages {
+		pages[code] = name
+	}
+	for code, name := range pages {
+		data, err := os.ReadFile(s.localPath(name))
+		if err != nil {
+			if _, configured := serve.ErrorPages[code]; configured {
+				log.Printf("读取 %d 错误页面失败: %v", code, err)
+			}
+			continue
+		}
+		s.errorPages[code] = data
+	}
+	return s
+}
+
+// localPath 将 URL 路径转换为目录中的文件路径，以目录为根清理，不会访问目录以外的文件
+func (s *fileServer) localPath(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.errorPages) > 0 {
+		w = &errorPageWriter{ResponseWriter: w, pages: s.errorPages, method: r.Method}
+	}
+
+	upath := path.Clean("/" + r.URL.Path)
+	trailingSlash := upath != "/" && strings.HasSuffix(r.URL.Path, "/")
+	// 拦截对 .git 目录及 .gitignore 等文件的访问
+	if strings.HasPrefix(upath, "/.git") {
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if stat, ok := s.stat(upath); ok {
+		if stat.IsDir() {
+			// 简洁 URL 先查找 .html 再查找目录（与 GitHub Pages 一致）：/about 返回 about.html，/about/ 仍为目录
+			if s.serve.CleanURLs && upath != "/" && !trailingSlash {
+				if html, ok := s.stat(upath + ".html"); ok && !html.IsDir() {
+					s.serveFile(w, r, upath+".html")
+					return
+				}
+			}
+			s.serveDir(w, r, upath, trailingSlash)
+			return
+		}
+		// 索引文件重定向到所在目录
+		base := path.Base(upath)
+		if s.isIndexFile(base) {
+			localRedirect(w, r, "./")
+			return
+		}
+		// 启用简洁 URL 时去掉 .html 后缀，去掉后的地址优先返回该文件，同名目录存在时也不受影响
+		if s.serve.CleanURLs && path.Ext(base) == ".html" {
+			if other, ok := s.stat(strings.TrimSuffix(upath, ".html")); !ok || other.IsDir() {
+				localRedirect(w, r, strings.TrimSuffix(base, ".html"))
+				return
+			}
+		}
+		if trailingSlash {
+			localRedirect(w, r, "../"+base)
+			return
+		}
+		s.serveFile(w, r, upath)
+		return
+	}
+
+	// 简洁 URL: /about 对应 about.html
+	if s.serve.CleanURLs && path.Ext(upath) != ".html" {
+		if stat, ok := s.stat(upath + ".html"); ok && !stat.IsDir() {
+			if trailingSlash {
+				localRedirect(w, r, "../"+path.Base(upath))
+				return
+			}
+			s.serveFile(w, r, upath+".html")
+			return
+		}
+	}
+
+	if s.serve.SPA && (r.Method == http.MethodGet || r.Method == http.MethodHead) && path.Ext(upath) == "" {
+		s.serveFallback(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// serveDir 目录请求: 补全末尾的 /，返回第一个存在的索引文件，没有索引文件时按配置列出目录
+func (s *fileServer) serveDir(w http.ResponseWriter, r *http.Request, upath string, trailingSlash bool) {
+	if upath != "/" && !trailingSlash {
+		localRedirect(w, r, path.Base(upath)+"/")
+		return
+	}
+	for _, index := range s.serve.GetIndexFiles() {
+		name := path.Join(upath, index)
+		if stat, ok := s.stat(name); ok && !stat.IsDir() {
+			s.serveFile(w, r, name)
+			return
+		}
+	}
+	s.serveListing(w, r, upath)
+}
+
+// isIndexFile 判断文件名是否为索引文件
+func (s *fileServer) isIndexFile(name string) bool {
+	for _, index := range s.serve.GetIndexFiles() {
+		if name == index {
+			return true
+		}
+	}
+	return false
+}
+
+// stat 返回 URL 路径对应的文件信息
+func (s *fileServer) stat(upath string) (os.FileInfo, bool) {
+	f, err := s.fs.Open(upath)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, false
+	}
+	return stat, true
+}
+
+// serveFile 返回文件内容，支持条件请求与范围请求
+func (s *fileServer) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	if cacheControl := s.cacheControl(name); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	hash := s.blobHash(name, stat, f)
+	if s.serve.Compress && s.serveCompressed(w, r, name, stat, f, hash) {
+		return
+	}
+	if hash != "" {
+		w.Header().Set("ETag", `"`+hash+`"`)
+	}
+	http.ServeContent(w, r, stat.Name(), stat.ModTime(), f)
+}
+
+// serveFallback 单页应用模式下以 200 返回回退页面，由前端路由处理路径
+func (s *fileServer) serveFallback(w http.ResponseWriter, r *http.Request) {
+	name := s.serve.Fallback
+	if name == "" {
+		name = config.DefaultFallback
+	}
+	s.serveFile(w, r, path.Clean("/"+name))
+}
+
+// localRedirect 使用相对地址重定向，挂载在 URL 前缀下时同样有效，保留查询参数
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// errorPageWriter 在响应错误状态码时改为输出对应的错误页面，丢弃原有的错误内容
+type errorPageWriter struct {
+	http.ResponseWriter
+	pages  map[int][]byte
+	method string
+	// replaced 已输出错误页面，之后的写入被丢弃
+	replaced bool
+}
+
+func (w *errorPageWriter) WriteHeader(code int) {
+	page, ok := w.pages[code]
+	if !ok || w.replaced {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.replaced = true
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.ResponseWriter.WriteHeader(code)
+	if w.method != http.MethodHead {
+		w.ResponseWriter.Write(page)
+	}
+}
+
+func (w *errorPageWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git2Web/config"
+	"git2Web/history"
+	"git2Web/repo"
+	"git2Web/security"
+)
+
+// maxHistoryError 部署历史中保留的错误信息上限，构建失败时错误中包含构建输出
+const maxHistoryError = 4096
+
+// deployHistory 部署历史存储，未初始化时不记录
+var deployHistory *history.Store
+
+// InitHistory 打开部署历史存储，路径为空时使用默认路径
+func InitHistory(path string) error {
+	if path == "" {
+		path = config.DefaultHistoryPath
+	}
+	store, err := history.Open(path)
+	if err != nil {
+		return err
+	}
+	deployHistory = store
+	return nil
+}
+
+// RecordHistory 记录一次更新尝试，partition 非空时从该分区读取部署的提交信息
+func RecordHistory(site *config.Site, trigger string, start time.Time, partition string, err error) {
+	if deployHistory == nil {
+		return
+	}
+	now := time.Now()
+	record := &history.Record{
+		Site:       site.Label(),
+		Trigger:    trigger,
+		Partition:  partition,
+		StartedAt:  start,
+		FinishedAt: now,
+		DurationMs: now.Sub(start).Milliseconds(),
+		Result:     history.ResultSuccess,
+	}
+	if partition != "" {
+		if state, err := repo.GetRepoState(site.GetPartitionPath(partition)); err == nil {
+			record.Commit = state.Commit
+			record.Ref = state.Ref
+			record.Author = state.Author
+			record.Message = state.Message
+		}
+		if err == nil {
+			record.Version = site.Partitions[partition].Version
+		}
+	}
+	if err != nil {
+		record.Result = history.ResultFailed
+		record.Error = err.Error()
+		if len(record.Error) > maxHistoryError {
+			record.Error = record.Error[:maxHistoryError] + "..."
+		}
+	}
+	if err := deployHistory.Append(record); err != nil {
+		log.Printf("记录部署历史失败: %v", err)
+	}
+}
+
+// historyHandler 部署历史查询接口
+//
+//	GET /history[?site=<name>][&page=1][&per_page=20]  分页查询，最新的记录在前
+//	GET /history?at=<RFC3339 时间>[&site=<name>]        查询该时刻正在提供服务的部署
+func historyHandler(config *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !security.ValidateToken(r, config.GetAdminToken()) {
+			http.Error(w, "未授权的请求", http.StatusUnauthorized)
+			return
+		}
+		if deployHistory == nil {
+			http.Error(w, "部署历史未启用", http.StatusServiceUnavailable)
+			return
+		}
+
+		query := r.URL.Query()
+		siteName := query.Get("site")
+		if siteName != "" || len(config.AllSites()) == 1 {
+			site := config.FindSite(siteName)
+			if site == nil {
+				http.Error(w, "未找到站点", http.StatusNotFound)
+				return
+			}
+			siteName = site.Label()
+		}
+
+		var result interface{}
+		if at := query.Get("at"); at != "" {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("时间格式无效，应为 RFC3339: %v", err), http.StatusBadRequest)
+				return
+			}
+			if siteName == "" {
+				http.Error(w, "查询某一时刻的部署需要指定 site", http.StatusBadRequest)
+				return
+			}
+			record, err := deployHistory.LiveAt(siteName, t)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result = map[string]interface{}{"site": siteName, "at": t, "record": record}
+		} else {
+			q := history.Query{
+				Site:    siteName,
+				Page:    queryInt(query.Get("page"), 1, 1, 1<<30),
+				PerPage: queryInt(query.Get("per_page"), 20, 1, 100),
+			}
+			records, total, err := deployHistory.List(q)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result = map[string]interface{}{
+				"total":    total,
+				"page":     q.Page,
+				"per_page": q.PerPage,
+				"records":  records,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// queryInt 解析整数查询参数，缺省或无效时返回默认值，并限制在 [min, max] 范围内
+func queryInt(s string, def, min, max int) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
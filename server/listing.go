@@ -0,0 +1,181 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"git2Web/config"
+	"git2Web/repo"
+)
+
+// listingEntry 目录列表中的一项
+type listingEntry struct {
+	Name    string
+	Href    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+}
+
+// listingCrumb 路径导航中的一级
+type listingCrumb struct {
+	Name string
+	Href string
+}
+
+// listingPage 目录列表页面的数据
+type listingPage struct {
+	Path    string
+	Crumbs  []listingCrumb
+	Parent  bool
+	Entries []listingEntry
+}
+
+var listingTemplate = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"size": formatSize,
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Path}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 960px; padding: 0 1em; color: #24292f; }
+nav { font-size: 1.25em; margin-bottom: 1em; }
+a { color: #0969da; text-decoration: none; }
+a:hover { text-decoration: underline; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: .4em .8em; border-bottom: 1px solid #d0d7de; text-align: left; }
+th { color: #57606a; font-weight: normal; }
+td.size, td.time, th.size, th.time { text-align: right; white-space: nowrap; color: #57606a; }
+</style>
+</head>
+<body>
+<nav>{{range $i, $c := .Crumbs}}{{if $i}} / {{end}}{{if $c.Href}}<a href="{{$c.Href}}">{{$c.Name}}</a>{{else}}{{$c.Name}}{{end}}{{end}}</nav>
+<table>
+<thead><tr><th>名称</th><th class="size">大小</th><th class="time">修改时间</th></tr></thead>
+<tbody>
+{{if .Parent}}<tr><td><a href="../">../</a></td><td class="size"></td><td class="time"></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td class="size">{{if not .IsDir}}{{size .Size}}{{end}}</td><td class="time">{{time .ModTime}}</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// serveListing 按站点配置处理没有索引文件的目录
+func (s *fileServer) serveListing(w http.ResponseWriter, r *http.Request, upath string) {
+	switch s.serve.Listing {
+	case config.ListingOff:
+		code := s.serve.GetListingStatus()
+		http.Error(w, http.StatusText(code), code)
+	case config.ListingHTML:
+		s.serveListingPage(w, r, upath)
+	default:
+		s.files.ServeHTTP(w, r)
+	}
+}
+
+// serveListingPage 输出带文件大小、修改时间与路径导航的目录列表
+// 修改时间取自最后一次修改该条目的提交，未提交的文件使用文件系统中的修改时间
+func (s *fileServer) serveListingPage(w http.ResponseWriter, r *http.Request, upath string) {
+	f, err := s.fs.Open(upath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		http.Error(w, "读取目录失败", http.StatusInternalServerError)
+		return
+	}
+
+	modTimes := s.modTimes(upath)
+	page := listingPage{Path: upath, Parent: upath != "/", Crumbs: listingCrumbs(upath)}
+	for _, info := range infos {
+		name := info.Name()
+		// 与访问控制一致，不列出 .git 目录及 .gitignore 等文件
+		if strings.HasPrefix(name, ".git") {
+			continue
+		}
+		entry := listingEntry{
+			Name:    name,
+			Href:    (&url.URL{Path: name}).String(),
+			IsDir:   info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+		if entry.IsDir {
+			entry.Href += "/"
+		}
+		if t, ok := modTimes[name]; ok {
+			entry.ModTime = t
+		}
+		page.Entries = append(page.Entries, entry)
+	}
+	// 目录在前，按名称排序
+	sort.Slice(page.Entries, func(i, j int) bool {
+		a, b := page.Entries[i], page.Entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		return a.Name < b.Name
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := listingTemplate.Execute(w, page); err != nil {
+		log.Printf("输出目录列表失败: %v", err)
+	}
+}
+
+// modTimes 返回目录中各条目最后修改的提交时间，按目录缓存，部署新版本时随处理器一起替换
+func (s *fileServer) modTimes(upath string) map[string]time.Time {
+	if cached, ok := s.listingTimes.Load(upath); ok {
+		return cached.(map[string]time.Time)
+	}
+	// 上传的构建产物没有仓库，读取失败时使用文件系统中的修改时间
+	times, _ := repo.LastModified(s.repoPath, s.localPath(upath))
+	s.listingTimes.Store(upath, times)
+	return times
+}
+
+// listingCrumbs 根据目录路径生成路径导航，使用相对链接，挂载在 URL 前缀下时同样有效
+func listingCrumbs(upath string) []listingCrumb {
+	var names []string
+	if upath != "/" {
+		names = strings.Split(strings.Trim(upath, "/"), "/")
+	}
+	crumbs := []listingCrumb{{Name: "/", Href: strings.Repeat("../", len(names))}}
+	for i, name := range names {
+		crumbs = append(crumbs, listingCrumb{Name: name, Href: strings.Repeat("../", len(names)-1-i)})
+	}
+	// 当前目录不需要链接
+	crumbs[len(crumbs)-1].Href = ""
+	return crumbs
+}
+
+// formatSize 将字节数格式化为便于阅读的大小
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
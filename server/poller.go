@@ -0,0 +1,133 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"git2Web/config"
+	"git2Web/history"
+	"git2Web/repo"
+	"git2Web/schedule"
+)
+
+// pollStatus 站点轮询的状态，在 /health 中报告
+type pollStatus struct {
+	Schedule  string    `json:"schedule"`
+	LastCheck time.Time `json:"last_check"`
+	NextCheck time.Time `json:"next_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// 各站点的轮询状态
+var (
+	pollStatuses      = make(map[*config.Site]*pollStatus)
+	pollStatusesMutex sync.Mutex
+)
+
+// StartPoller 按站点配置的间隔或 cron 表达式定期检查远程仓库，
+// 部署目标的提交与当前提供服务的提交不同时执行常规更新流程；未配置轮询时直接返回
+func StartPoller(cfg *config.Config, site *config.Site, configPath string) error {
+	sched, err := schedule.Parse(site.PollInterval, site.PollCron)
+	if err != nil || sched == nil {
+		return err
+	}
+	desc := site.PollCron
+	if desc == "" {
+		desc = "every " + site.PollInterval
+	}
+	log.Printf("[%s] 已启用定时轮询: %s", site.Label(), desc)
+
+	go func() {
+		// 更新失败的提交不再重复尝试，等待远程出现新的提交或由 Webhook 触发
+		failedCommit := ""
+		for {
+			next := sched.Next(time.Now())
+			if next.IsZero() {
+				log.Printf("[%s] cron 表达式 %s 没有下一次触发时间，停止轮询", site.Label(), desc)
+				return
+			}
+			setPollStatus(site, func(s *pollStatus) {
+				s.Schedule = desc
+				s.NextCheck = next
+			})
+			time.Sleep(time.Until(next))
+
+			commit, skipped, err := pollSite(cfg, site, configPath, failedCommit)
+			if skipped {
+				// 远程仍为跳过的提交，保留上次的错误
+				setPollStatus(site, func(s *pollStatus) { s.LastCheck = time.Now() })
+				continue
+			}
+			if err != nil {
+				failedCommit = commit
+			} else {
+				failedCommit = ""
+			}
+			setPollStatus(site, func(s *pollStatus) {
+				s.LastCheck = time.Now()
+				s.LastError = ""
+				if err != nil {
+					s.LastError = err.Error()
+				}
+			})
+		}
+	}()
+	return nil
+}
+
+// pollSite 检查一次远程仓库，有更新时执行更新流程
+// 返回远程部署目标的提交；skipCommit 为上次更新失败的提交，远程仍为该提交或最近一次回滚前的提交时不更新，skipped 为 true
+func pollSite(cfg *config.Config, site *config.Site, configPath, skipCommit string) (commit string, skipped bool, err error) {
+	unlock := lockSite(site)
+	defer unlock()
+
+	remote, err := repo.RemoteTargetCommit(site)
+	if err != nil {
+		log.Printf("[%s] 轮询远程仓库失败: %v", site.Label(), err)
+		return "", false, err
+	}
+	if _, served, err := repo.GetHeadRef(site.GetActiveTargetPath()); err == nil && strings.HasPrefix(served, remote) {
+		return remote, false, nil
+	}
+	if remote == skipCommit {
+		return remote, true, nil
+	}
+	// 回滚后提供服务的提交与远程不同，远程出现新的提交前不重新部署被回滚的版本
+	if rb := site.LastRollback; rb != nil && rb.From != "" && strings.HasPrefix(rb.From, remote) {
+		return remote, true, nil
+	}
+
+	log.Printf("\n----------\n[%s] 轮询发现新的提交: %s，开始更新", site.Label(), remote)
+	start := time.Now()
+	if err := deploySite(cfg, site, configPath, history.TriggerPoll); err != nil {
+		log.Printf("[%s] 更新失败: %v", site.Label(), err)
+		return remote, false, err
+	}
+	log.Printf("[%s] 仓库成功更新,用时: %s", site.Label(), time.Since(start))
+	return remote, false, nil
+}
+
+// getPollStatus 返回站点轮询状态的副本，未启用轮询时返回 nil
+func getPollStatus(site *config.Site) *pollStatus {
+	pollStatusesMutex.Lock()
+	defer pollStatusesMutex.Unlock()
+	if s, ok := pollStatuses[site]; ok {
+		copied := *s
+		return &copied
+	}
+	return nil
+}
+
+// setPollStatus 修改站点的轮询状态
+func setPollStatus(site *config.Site, update func(s *pollStatus)) {
+	pollStatusesMutex.Lock()
+	defer pollStatusesMutex.Unlock()
+	s, ok := pollStatuses[site]
+	if !ok {
+		s = &pollStatus{}
+		pollStatuses[site] = s
+	}
+	update(s)
+}
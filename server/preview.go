@@ -0,0 +1,335 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git2Web/build"
+	"git2Web/config"
+	"git2Web/repo"
+)
+
+// previewPrefix 未配置预览端口时，预览在站点端口上的 URL 前缀
+const previewPrefix = "/_preview/"
+
+// 各站点预览的静态文件处理器，按预览名称索引
+var (
+	previewHandlers      = make(map[*config.Site]map[string]http.Handler)
+	previewHandlersMutex sync.RWMutex
+)
+
+// previewMutexes 每个预览一把锁，预览的更新不阻塞站点本身的更新
+var previewMutexes sync.Map
+
+type previewKey struct {
+	site *config.Site
+	name string
+}
+
+// lockPreview 锁定站点的一个预览，返回解锁函数
+func lockPreview(site *config.Site, name string) func() {
+	mu, _ := previewMutexes.LoadOrStore(previewKey{site, name}, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// previewName 将分支名转换为可用于 URL 与目录名的预览名称，例如 feature/login -> feature-login
+func previewName(branch string) string {
+	var b strings.Builder
+	for _, r := range branch {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	return b.String()
+}
+
+// previewPath 返回预览检出的目录
+func previewPath(site *config.Site, name string) string {
+	return filepath.Join(site.PreviewDir(), name)
+}
+
+// previewBasePath 返回预览的 URL 路径前缀，以 / 结尾
+func previewBasePath(site *config.Site, name string) string {
+	if site.Preview != nil && site.Preview.Port != "" {
+		return "/" + name + "/"
+	}
+	return previewPrefix + name + "/"
+}
+
+// handlePreviewPush 处理推送到预览分支的事件: 更新分支的预览，分支被删除时清理预览
+// 返回 false 表示推送的是生产分支或不需要预览的分支，由常规流程更新站点
+func handlePreviewPush(cfg *config.Config, site *config.Site, configPath string, event *pushEvent) (bool, error) {
+	if event.Branch == "" || !site.PreviewBranchMatches(event.Branch) {
+		return false, nil
+	}
+	name := previewName(event.Branch)
+	if event.Deleted {
+		if _, ok := site.GetPreview(name); !ok {
+			return false, nil
+		}
+		return true, removePreview(cfg, site, configPath, name)
+	}
+
+	production := site.Branch
+	if production == "" {
+		var err error
+		if production, err = repo.RemoteDefaultBranch(site); err != nil {
+			return true, fmt.Errorf("获取远程默认分支失败: %w", err)
+		}
+	}
+	if event.Branch == production {
+		return false, nil
+	}
+	info := config.PreviewInfo{Branch: event.Branch}
+	return true, deployPreview(cfg, site, configPath, name, site.ForBranch(event.Branch), info)
+}
+
+// handlePullRequest 处理合并请求事件: 打开或推送新提交时部署合并请求头引用的预览，关闭或合并时删除预览
+func handlePullRequest(cfg *config.Config, site *config.Site, configPath string, event *pullRequestEvent) error {
+	name := fmt.Sprintf("pr-%d", event.Number)
+	if event.Closed {
+		return removePreview(cfg, site, configPath, name)
+	}
+	info := config.PreviewInfo{
+		Branch:      event.Branch,
+		PullRequest: event.Number,
+		Title:       event.Title,
+	}
+	return deployPreview(cfg, site, configPath, name, site.ForRef(event.Ref), info)
+}
+
+// deployPreview 将 previewSite 的部署目标检出到预览目录并按站点配置构建，然后提供服务
+// 预览目录增量更新，首次部署时从活动分区复用对象
+func deployPreview(cfg *config.Config, site *config.Site, configPath, name string, previewSite *config.Site, info config.PreviewInfo) error {
+	unlock := lockPreview(site, name)
+	defer unlock()
+
+	if prev, ok := site.GetPreview(name); ok && (prev.Branch != info.Branch || prev.PullRequest != info.PullRequest) {
+		return fmt.Errorf("预览名称 %s 已被分支 %s 使用", name, prev.Branch)
+	}
+
+	path := previewPath(site, name)
+	log.Printf("[%s] 开始部署 %s 的预览: %s", site.Label(), previewSite.DescribeTargetRef(), path)
+	if err := repo.SyncPartition(previewSite, path, site.GetActiveTargetPath()); err != nil {
+		return fmt.Errorf("更新预览失败: %w", err)
+	}
+	_, commit, err := repo.GetHeadRef(path)
+	if err != nil {
+		return fmt.Errorf("读取预览提交失败: %w", err)
+	}
+	if site.HasBuild() {
+		buildInfo, err := build.Run(previewSite, path, commit)
+		if err != nil {
+			return fmt.Errorf("构建预览失败: %w\n%s", err, buildInfo.Output)
+		}
+	}
+
+	info.Commit = commit
+	info.UpdatedAt = time.Now()
+	site.RecordPreview(name, info)
+	if err := cfg.SaveConfig(configPath); err != nil {
+		log.Printf("保存配置文件失败: %v", err)
+	}
+	registerPreview(site, name)
+	log.Printf("[%s] 预览已部署: %s (%s)", site.Label(), previewBasePath(site, name), commit)
+	return nil
+}
+
+// removePreview 停止提供预览并删除预览目录与记录
+func removePreview(cfg *config.Config, site *config.Site, configPath, name string) error {
+	return removePreviewIf(cfg, site, configPath, name, nil)
+}
+
+// removePreviewIf 锁定预览后 remove 仍返回 true 时删除预览，remove 为 nil 时总是删除
+func removePreviewIf(cfg *config.Config, site *config.Site, configPath, name string, remove func(config.PreviewInfo) bool) error {
+	unlock := lockPreview(site, name)
+	defer unlock()
+
+	info, ok := site.GetPreview(name)
+	if !ok || (remove != nil && !remove(info)) {
+		return nil
+	}
+	previewHandlersMutex.Lock()
+	delete(previewHandlers[site], name)
+	previewHandlersMutex.Unlock()
+
+	site.RemovePreview(name)
+	if err := cfg.SaveConfig(configPath); err != nil {
+		log.Printf("保存配置文件失败: %v", err)
+	}
+	if err := os.RemoveAll(previewPath(site, name)); err != nil {
+		return fmt.Errorf("删除预览目录失败: %w", err)
+	}
+	log.Printf("[%s] 预览已删除: %s", site.Label(), name)
+	return nil
+}
+
+// registerPreview 为预览目录创建静态文件处理器
+func registerPreview(site *config.Site, name string) {
+	path := previewPath(site, name)
+	handler := newStaticHandler(path, site)
+	if site.CommitHeaders {
+		if state, err := repo.GetRepoState(path); err == nil {
+			handler = commitHeaders(handler, state)
+		}
+	}
+	handler = http.StripPrefix(strings.TrimSuffix(previewBasePath(site, name), "/"), handler)
+
+	previewHandlersMutex.Lock()
+	if previewHandlers[site] == nil {
+		previewHandlers[site] = make(map[string]http.Handler)
+	}
+	previewHandlers[site][name] = handler
+	previewHandlersMutex.Unlock()
+}
+
+// loadPreviews 启动时恢复记录中仍存在的预览
+func loadPreviews(site *config.Site) {
+	for name := range site.GetPreviews() {
+		if _, err := os.Stat(previewPath(site, name)); err != nil {
+			log.Printf("[%s] 预览目录不存在，跳过: %s", site.Label(), name)
+			continue
+		}
+		registerPreview(site, name)
+	}
+}
+
+// servePreview 将 prefix 之后第一段路径作为预览名称，把请求交给对应的预览
+func servePreview(w http.ResponseWriter, r *http.Request, site *config.Site, prefix string) {
+	name, rest, found := strings.Cut(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	previewHandlersMutex.RLock()
+	handler := previewHandlers[site][name]
+	previewHandlersMutex.RUnlock()
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	// 预览根目录需要以 / 结尾，页面中的相对链接才能正确解析
+	if !found && rest == "" {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// previewRouter 预览端口的处理器，按 Host 选择站点后以 /<名称>/ 分发到预览
+func previewRouter(sites []*config.Site) http.Handler {
+	selectSite := siteSelector(sites)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := selectSite(r)
+		if site == nil {
+			http.NotFound(w, r)
+			return
+		}
+		servePreview(w, r, site, "/")
+	})
+}
+
+// previewStatus 预览列表中的一项
+type previewStatus struct {
+	Site string `json:"site"`
+	Name string `json:"name"`
+	config.PreviewInfo
+	URL string `json:"url"`
+}
+
+// previewURL 返回预览的访问地址，主机优先使用站点配置的域名，其次使用请求的主机
+func previewURL(r *http.Request, site *config.Site, name string) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if len(site.Hosts) > 0 {
+		host = site.Hosts[0]
+	}
+	port := site.StaticPort
+	if site.Preview != nil && site.Preview.Port != "" {
+		port = site.Preview.Port
+	}
+	return "http://" + net.JoinHostPort(host, port) + previewBasePath(site, name)
+}
+
+// previewsHandler 预览列表接口，GET /previews[?site=<name>]，按站点与名称排序
+func previewsHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sites := cfg.AllSites()
+		if name := r.URL.Query().Get("site"); name != "" {
+			site := cfg.FindSite(name)
+			if site == nil {
+				http.Error(w, "未找到站点", http.StatusNotFound)
+				return
+			}
+			sites = []*config.Site{site}
+		}
+
+		list := make([]previewStatus, 0)
+		for _, site := range sites {
+			previews := site.GetPreviews()
+			names := make([]string, 0, len(previews))
+			for name := range previews {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				list = append(list, previewStatus{
+					Site:        site.Label(),
+					Name:        name,
+					PreviewInfo: previews[name],
+					URL:         previewURL(r, site, name),
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"previews": list})
+	}
+}
+
+// StartPreviewCleanup 定期删除超过 ttl 没有更新的预览；未配置预览或 ttl 时直接返回
+func StartPreviewCleanup(cfg *config.Config, site *config.Site, configPath string) error {
+	if site.Preview == nil || site.Preview.TTL == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(site.Preview.TTL)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("无效的预览 ttl: %s", site.Preview.TTL)
+	}
+	interval := ttl / 10
+	if interval < time.Minute {
+		interval = time.Minute
+	} else if interval > time.Hour {
+		interval = time.Hour
+	}
+	log.Printf("[%s] 预览超过 %s 未更新将自动删除", site.Label(), ttl)
+
+	go func() {
+		expired := func(info config.PreviewInfo) bool { return time.Since(info.UpdatedAt) > ttl }
+		for {
+			// 先在副本中找出过期的预览，删除时锁定预览后再次确认，期间重新部署的预览不会被删除
+			for name, info := range site.GetPreviews() {
+				if !expired(info) {
+					continue
+				}
+				log.Printf("[%s] 预览 %s 已超过 %s 未更新", site.Label(), name, ttl)
+				if err := removePreviewIf(cfg, site, configPath, name, expired); err != nil {
+					log.Printf("[%s] 删除预览失败: %v", site.Label(), err)
+				}
+			}
+			time.Sleep(interval)
+		}
+	}()
+	return nil
+}
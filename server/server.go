@@ -1,183 +1,206 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"strings"
-	"sync"
 	"time"
 
 	"git2Web/config"
+	"git2Web/history"
 	"git2Web/repo"
 	"git2Web/security"
 )
 
 var StartTime time.Time
-var staticServer *http.Server
-var staticServerMutex sync.Mutex
 
 func init() {
 	StartTime = time.Now()
 }
 
-func webhookHandler(config *config.Config, configPath string) http.HandlerFunc {
+// clearWriteDeadline 取消当前响应的写入超时，用于执行更新、构建等耗时操作的接口
+func clearWriteDeadline(w http.ResponseWriter) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("取消写入超时失败: %v", err)
+	}
+}
+
+// webhookHandler 站点的 Webhook 处理器
+func webhookHandler(config *config.Config, site *config.Site, configPath string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("\n----------\n收到Webhook请求")
+		log.Printf("\n----------\n[%s] 收到Webhook请求", site.Label())
 		updateStartTime := time.Now()
 
 		// 验证请求
-		if !security.ValidateWebhook(r, config.WebhookSecret) {
+		if !security.ValidateWebhook(r, site.WebhookSecret) {
 			http.Error(w, "未授权的请求", http.StatusUnauthorized)
 			log.Println("Webhook 验证失败")
 			return
 		}
 
-		// 使用 AB 分区策略更新仓库
-		if config.LfsEnabled {
-			log.Println("使用 AB 分区策略更新 LFS 仓库")
-			inactivePath := config.GetInactiveTargetPath()
-
-			// 如果非激活分区存在，则先删除
-			if _, err := os.Stat(inactivePath); err == nil {
-				log.Printf("清理非激活分区: %s", inactivePath)
-				if err := os.RemoveAll(inactivePath); err != nil {
-					http.Error(w, fmt.Sprintf("清理非激活分区失败: %v", err), http.StatusInternalServerError)
-					log.Printf("清理非激活分区失败: %v", err)
-					return
-				}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+		if err != nil {
+			http.Error(w, "读取请求失败", http.StatusBadRequest)
+			return
+		}
+		// 更新与构建可能超过服务器的写入超时，调用方需要收到结果
+		clearWriteDeadline(w)
+
+		// 合并请求事件只更新对应的预览
+		if event := parsePullRequestEvent(r, body); event != nil && site.Preview != nil && site.Preview.PullRequests {
+			// 未配置密钥时任何人都能伪造事件内容，无法判断合并请求的来源
+			if site.WebhookSecret == "" {
+				http.Error(w, "未配置 webhook_secret，不处理合并请求事件", http.StatusForbidden)
+				log.Printf("[%s] 未配置 webhook_secret，忽略合并请求 #%d", site.Label(), event.Number)
+				return
 			}
-
-			// 克隆到非激活分区
-			log.Printf("开始克隆到非激活分区: %s", inactivePath)
-			if err := repo.CloneRepoToPath(config, inactivePath); err != nil {
-				http.Error(w, fmt.Sprintf("克隆仓库失败: %v", err), http.StatusInternalServerError)
-				log.Printf("克隆仓库失败: %v", err)
+			// 派生仓库的代码不可信，构建命令可以读取服务器上的文件，默认不部署；源仓库与 repo_url 不一致时同样视为派生仓库
+			if !event.Closed && !site.Preview.AllowForks && (event.Fork || !event.fromRepo(site.RepoURL)) {
+				fmt.Fprintf(w, "合并请求 #%d 来自派生仓库，未部署预览\n", event.Number)
+				log.Printf("[%s] 合并请求 #%d 来自派生仓库，未启用 preview.allow_forks，跳过", site.Label(), event.Number)
 				return
 			}
+			if err := handlePullRequest(config, site, configPath, event); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				log.Printf("[%s] 更新合并请求 #%d 的预览失败: %v", site.Label(), event.Number, err)
+				return
+			}
+			fmt.Fprintln(w, "合并请求预览已更新,用时:", time.Since(updateStartTime).String())
+			return
+		}
 
-			// 切换活动分区
-			log.Println("切换活动分区")
-			config.SwitchActivePartition()
-
-			// 保存配置更改
-			if err := config.SaveConfig(configPath); err != nil {
-				log.Printf("保存配置文件失败: %v", err)
-				// 但不阻止服务切换
+		// 推送到预览分支时只更新该分支的预览
+		if event := parsePushEvent(r, body); event != nil && site.Preview != nil {
+			handled, err := handlePreviewPush(config, site, configPath, event)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				log.Printf("[%s] 更新预览失败: %v", site.Label(), err)
+				return
 			}
+			if handled {
+				fmt.Fprintln(w, "预览已更新,用时:", time.Since(updateStartTime).String())
+				return
+			}
+		}
+
+		unlock := lockSite(site)
+		defer unlock()
 
-			// 重启静态文件服务
-			log.Println("重启静态文件服务到新分区")
-			RestartStaticServer(config.GetActiveTargetPath(), config.StaticPort)
+		if err := deploySite(config, site, configPath, history.TriggerWebhook); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Printf("[%s] 更新失败: %v", site.Label(), err)
+			return
+		}
 
+		if site.UsePartitions() {
 			fmt.Fprintln(w, "仓库成功更新并切换服务到新版本,用时:", time.Since(updateStartTime).String())
 			log.Println("仓库成功更新并切换服务到新版本,用时:", time.Since(updateStartTime).String())
 		} else {
-			// 非 LFS 仓库使用常规更新方式
-			err := repo.PullRepo(config)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				log.Printf("拉取仓库时出错: %v", err)
-				return
-			}
 			fmt.Fprintln(w, "仓库成功更新,用时:", time.Since(updateStartTime).String())
 			log.Println("仓库成功更新,用时:", time.Since(updateStartTime).String())
 		}
 	}
 }
 
+// siteStatus 汇总站点的仓库与部署状态，运行状态读取自快照，不会与进行中的部署冲突
+func siteStatus(site *config.Site) map[string]interface{} {
+	state := site.State()
+	activePath := site.GetPartitionPath(state.ActivePartition)
+	repoInfo := map[string]string{
+		"url":         site.RepoURL,
+		"active_path": activePath,
+		"partition":   state.ActivePartition,
+		"target":      site.DescribeTargetRef(),
+	}
+	// 报告当前实际提供服务的引用与提交
+	if ref, commit, err := repo.GetHeadRef(activePath); err == nil {
+		repoInfo["ref"] = ref
+		repoInfo["commit"] = commit
+	}
+	status := map[string]interface{}{
+		"name": site.Label(),
+		"repo": repoInfo,
+	}
+	if len(state.Partitions) > 0 {
+		status["partitions"] = state.Partitions
+	}
+	if state.LastRollback != nil {
+		status["last_rollback"] = state.LastRollback
+	}
+	if state.LastBuild != nil {
+		status["last_build"] = state.LastBuild
+	}
+	if len(state.Previews) > 0 {
+		status["previews"] = state.Previews
+	}
+	if poll := getPollStatus(site); poll != nil {
+		status["poll"] = poll
+	}
+
+	// 检查目标目录是否存在
+	_, err := os.Stat(activePath)
+	status["repoExists"] = err == nil
+	return status
+}
+
 // 健康检查端点
+// 只有一个站点时在顶层报告站点状态，多站点时在 sites 中逐个报告
 func healthCheckHandler(config *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		activePath := config.GetActiveTargetPath()
 		info := map[string]interface{}{
 			"status":  "healthy",
 			"version": config.Version,
 			"uptime":  time.Since(StartTime).String(),
-			"repo": map[string]string{
-				"url":         config.RepoURL,
-				"active_path": activePath,
-				"partition":   config.ActivePartition,
-			},
 		}
 
-		// 检查目标目录是否存在
-		_, err := os.Stat(activePath)
-		info["repoExists"] = err == nil
+		sites := config.AllSites()
+		if len(sites) == 1 {
+			for k, v := range siteStatus(sites[0]) {
+				info[k] = v
+			}
+		} else {
+			statuses := make([]map[string]interface{}, 0, len(sites))
+			for _, site := range sites {
+				statuses = append(statuses, siteStatus(site))
+			}
+			info["sites"] = statuses
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(info)
 	}
 }
 
-// NoGitFileServer 拦截对 .git 目录的访问
-func NoGitFileServer(root http.FileSystem) http.Handler {
-	fileServer := http.FileServer(root)
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasPrefix(r.URL.Path, "/.git") {
-			http.Error(w, "403 Forbidden", http.StatusForbidden)
-			return
-		}
-		fileServer.ServeHTTP(w, r)
-	})
-}
-
-// RestartStaticServer 重启静态文件服务器，指向新目录
-func RestartStaticServer(staticPath, port string) {
-	staticServerMutex.Lock()
-	defer staticServerMutex.Unlock()
-
-	// 如果服务已存在，先关闭
-	if staticServer != nil {
-		log.Println("正在关闭现有静态文件服务器...")
-
-		// 创建一个带超时的上下文
-		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
-		defer cancel()
-
-		// 创建一个带超时的上下文用于关闭服务
-		go func() {
-			if err := staticServer.Shutdown(ctx); err != nil {
-				log.Printf("关闭静态文件服务器时出错: %v", err)
-			}
-		}()
-		// 等待一小段时间确保服务关闭
-		time.Sleep(500 * time.Millisecond)
-	}
-
-	// 启动新服务
-	log.Printf("启动静态文件服务器，路径: %s, 端口: %s", staticPath, port)
+func ServeWebhook(config *config.Config, configPath string) {
 	mux := http.NewServeMux()
-	mux.Handle("/", NoGitFileServer(http.Dir(staticPath)))
-
-	staticServer = &http.Server{
-		Addr:         ":" + port,
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	// 只有一个站点时保留 /webhook，命名站点使用 /webhook/<name>
+	if site := config.FindSite(""); site != nil {
+		mux.HandleFunc("/webhook", webhookHandler(config, site, configPath))
+		log.Printf("Webhook 服务: http://IP:%s/webhook", config.WebhookPort)
 	}
-
-	go func() {
-		if err := staticServer.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("静态文件服务器错误: %v", err)
+	for _, site := range config.AllSites() {
+		if site.Name == "" {
+			continue
 		}
-	}()
-}
-
-func ServeStaticFiles(staticPath, port string) {
-	RestartStaticServer(staticPath, port)
-}
-
-func ServeWebhook(config *config.Config, configPath string) {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", webhookHandler(config, configPath))
+		mux.HandleFunc("/webhook/"+site.Name, webhookHandler(config, site, configPath))
+		log.Printf("站点 %s 的 Webhook 服务: http://IP:%s/webhook/%s", site.Name, config.WebhookPort, site.Name)
+	}
 	mux.HandleFunc("/health", healthCheckHandler(config))
+	mux.HandleFunc("/rollback", rollbackHandler(config, configPath))
+	mux.HandleFunc("/history", historyHandler(config))
+	mux.HandleFunc("/version", versionHandler(config))
+	mux.HandleFunc("/previews", previewsHandler(config))
+	mux.HandleFunc("/upload", uploadHandler(config, configPath))
 
-	log.Printf("Webhook 服务: http://IP:%s/webhook", config.WebhookPort)
 	log.Printf("健康检查端点: http://IP:%s/health", config.WebhookPort)
+	log.Printf("回滚接口: http://IP:%s/rollback", config.WebhookPort)
+	log.Printf("部署历史: http://IP:%s/history", config.WebhookPort)
+	log.Printf("版本信息: http://IP:%s/version", config.WebhookPort)
+	log.Printf("预览列表: http://IP:%s/previews", config.WebhookPort)
+	log.Printf("上传部署: http://IP:%s/upload", config.WebhookPort)
 
 	server := &http.Server{
 		Addr:         ":" + config.WebhookPort,
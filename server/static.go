@@ -0,0 +1,173 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"git2Web/config"
+	"git2Web/repo"
+)
+
+// 各站点当前的静态文件处理器，切换分区时整体替换，无需重启监听
+var (
+	siteHandlers      = make(map[*config.Site]http.Handler)
+	siteHandlersMutex sync.RWMutex
+)
+
+// ReloadStaticSite 将站点的静态文件服务切换到活动分区，活动分区的内容更新后也需要调用
+func ReloadStaticSite(site *config.Site) {
+	staticPath := site.GetServeRoot(site.GetActiveTargetPath())
+	log.Printf("[%s] 静态文件服务切换到: %s", site.Label(), staticPath)
+	handler := newStaticHandler(site.GetActiveTargetPath(), site)
+	if site.CommitHeaders {
+		if state, err := repo.GetRepoState(site.GetActiveTargetPath()); err == nil {
+			handler = commitHeaders(handler, state)
+		} else {
+			log.Printf("[%s] 读取仓库状态失败，响应中不添加版本头: %v", site.Label(), err)
+		}
+	}
+
+	siteHandlersMutex.Lock()
+	siteHandlers[site] = handler
+	siteHandlersMutex.Unlock()
+}
+
+// commitHeaders 在每个响应中添加当前提供服务的提交与引用
+func commitHeaders(next http.Handler, state *repo.RepoState) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Git-Commit", state.Commit)
+		w.Header().Set("X-Git-Ref", state.Ref)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeStaticFiles 为所有站点启动静态文件服务
+// 端口相同的站点共用一个监听，按请求的 Host 选择站点，未匹配时使用该端口上未配置 hosts 的站点；
+// 配置了预览端口的站点在预览端口上单独提供预览
+func ServeStaticFiles(cfg *config.Config) {
+	var ports, previewPorts []string
+	portSites := make(map[string][]*config.Site)
+	previewSites := make(map[string][]*config.Site)
+	for _, site := range cfg.AllSites() {
+		ReloadStaticSite(site)
+		loadPreviews(site)
+		if _, ok := portSites[site.StaticPort]; !ok {
+			ports = append(ports, site.StaticPort)
+		}
+		portSites[site.StaticPort] = append(portSites[site.StaticPort], site)
+
+		if site.Preview != nil && site.Preview.Port != "" {
+			if _, ok := previewSites[site.Preview.Port]; !ok {
+				previewPorts = append(previewPorts, site.Preview.Port)
+			}
+			previewSites[site.Preview.Port] = append(previewSites[site.Preview.Port], site)
+		}
+	}
+
+	for _, port := range ports {
+		log.Printf("启动静态文件服务器，端口: %s", port)
+		listenStatic(port, hostRouter(portSites[port]))
+	}
+	for _, port := range previewPorts {
+		log.Printf("启动预览服务器，端口: %s", port)
+		listenStatic(port, previewRouter(previewSites[port]))
+	}
+}
+
+// listenStatic 在端口上启动静态文件监听
+func listenStatic(port string, handler http.Handler) {
+	server := &http.Server{
+		Addr:         ":" + port,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Printf("静态文件服务器错误: %v", err)
+		}
+	}()
+}
+
+// siteSelector 返回按请求的 Host 选择站点的函数，未匹配时使用未配置 hosts 的站点
+func siteSelector(sites []*config.Site) func(r *http.Request) *config.Site {
+	hosts := make(map[string]*config.Site)
+	var fallback *config.Site
+	for _, site := range sites {
+		for _, host := range site.Hosts {
+			hosts[strings.ToLower(host)] = site
+		}
+		if len(site.Hosts) == 0 && fallback == nil {
+			fallback = site
+		}
+	}
+
+	return func(r *http.Request) *config.Site {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if site, ok := hosts[strings.ToLower(host)]; ok {
+			return site
+		}
+		return fallback
+	}
+}
+
+// hostRouter 按请求的 Host 将请求分发到站点的静态文件处理器
+func hostRouter(sites []*config.Site) http.Handler {
+	selectSite := siteSelector(sites)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site := selectSite(r)
+		if site != nil && site.Preview != nil && site.Preview.Port == "" && strings.HasPrefix(r.URL.Path, previewPrefix) {
+			servePreview(w, r, site, previewPrefix)
+			return
+		}
+
+		siteHandlersMutex.RLock()
+		handler := siteHandlers[site]
+		siteHandlersMutex.RUnlock()
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// newStaticHandler 根据站点的挂载与服务配置为分区构建静态文件处理器，未配置挂载时发布整个提供服务的目录
+func newStaticHandler(partitionPath string, site *config.Site) http.Handler {
+	root := site.GetServeRoot(partitionPath)
+	mounts := site.Mounts
+	if len(mounts) == 0 {
+		return newFileServer(root, partitionPath, "/", site.Serve)
+	}
+
+	mux := http.NewServeMux()
+	registered := make(map[string]bool)
+	for _, m := range mounts {
+		// 以 / 为根清理路径，防止通过 .. 访问仓库以外的目录
+		dir := filepath.Join(root, filepath.FromSlash(path.Clean("/"+m.Dir)))
+		prefix := path.Clean("/" + m.Prefix)
+		if registered[prefix] {
+			log.Printf("忽略重复的挂载前缀: %s", prefix)
+			continue
+		}
+		registered[prefix] = true
+
+		log.Printf("挂载目录 %s 到 URL 前缀 %s", dir, prefix)
+		handler := newFileServer(dir, partitionPath, prefix, site.Serve)
+		if prefix == "/" {
+			mux.Handle("/", handler)
+		} else {
+			mux.Handle(prefix+"/", http.StripPrefix(strings.TrimSuffix(prefix, "/"), handler))
+		}
+	}
+	return mux
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"git2Web/artifact"
+	"git2Web/config"
+	"git2Web/history"
+	"git2Web/repo"
+)
+
+// maxVersionLength 上传版本号的长度上限
+const maxVersionLength = 128
+
+// errUploadTooLarge 上传文件超过大小上限
+var errUploadTooLarge = errors.New("上传文件超过大小上限")
+
+// errUnsignedArtifact 站点要求签名，构建产物无法验证签名
+var errUnsignedArtifact = errors.New("站点配置了 signature，只接受可验证提交签名的 git bundle，不接受 tar.gz 与 zip")
+
+// uploadResult 上传部署的结果
+type uploadResult struct {
+	Site      string `json:"site"`
+	Version   string `json:"version"`
+	Format    string `json:"format"`
+	Partition string `json:"partition"`
+	Commit    string `json:"commit,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// uploadHandler 上传部署接口，POST /upload?version=<版本>[&site=<name>]
+// 请求体为 tar.gz、zip 或 git bundle 文件，格式按文件内容识别；只有一个站点时可省略 site
+func uploadHandler(cfg *config.Config, configPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("\n----------\n收到上传部署请求")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "仅支持 POST 请求", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeAdmin(w, r, cfg.GetAdminToken()) {
+			log.Println("上传部署请求验证失败")
+			return
+		}
+
+		site := cfg.FindSite(r.URL.Query().Get("site"))
+		if site == nil {
+			http.Error(w, "未找到站点", http.StatusNotFound)
+			return
+		}
+		if !site.UsePartitions() {
+			http.Error(w, "站点未使用 AB 分区，不支持上传部署", http.StatusConflict)
+			return
+		}
+		version := r.URL.Query().Get("version")
+		if version == "" || len(version) > maxVersionLength {
+			http.Error(w, "请通过 version 参数指定版本", http.StatusBadRequest)
+			return
+		}
+
+		// 上传的文件可能很大，不受服务器读写超时的限制
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+
+		start := time.Now()
+		file, err := receiveUpload(site, r.Body, cfg.GetUploadMaxSize())
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errUploadTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			log.Printf("[%s] 接收上传文件失败: %v", site.Label(), err)
+			return
+		}
+		defer os.Remove(file)
+
+		unlock := lockSite(site)
+		defer unlock()
+
+		result, err := deployUpload(cfg, site, configPath, file, version)
+		RecordHistory(site, history.TriggerUpload, start, result.Partition, err)
+		if err != nil {
+			status := http.StatusUnprocessableEntity
+			switch {
+			case errors.Is(err, errUnsignedArtifact):
+				status = http.StatusForbidden
+			case errors.Is(err, artifact.ErrTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, fmt.Sprintf("上传部署失败: %v", err), status)
+			log.Printf("[%s] 上传部署失败: %v", site.Label(), err)
+			return
+		}
+		result.Duration = time.Since(start).String()
+		log.Printf("[%s] 版本 %s 上传部署完成，用时: %s", site.Label(), version, result.Duration)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// receiveUpload 将请求体保存到分区目录旁的临时文件，返回文件路径
+func receiveUpload(site *config.Site, body io.Reader, maxSize int64) (string, error) {
+	dir := filepath.Dir(site.GetInactiveTargetPath())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建目录失败: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	n, err := io.Copy(f, io.LimitReader(body, maxSize+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxSize {
+		err = fmt.Errorf("%w（%d MB）", errUploadTooLarge, maxSize>>20)
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("上传文件为空")
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// deployUpload 将上传的文件部署到非激活分区，检查通过后切换活动分区
+// tar.gz 与 zip 视为构建好的产物，解压到提供服务的根目录；git bundle 视为源码，检出后按站点配置构建
+// 配置了 signature 的站点只接受 git bundle，构建产物没有可验证的签名
+// 解包、构建与检查都在临时目录中进行，失败时非激活分区中的上一个部署保持不变，仍可回滚
+func deployUpload(cfg *config.Config, site *config.Site, configPath, file, version string) (*uploadResult, error) {
+	result := &uploadResult{Site: site.Label(), Version: version}
+	format, err := artifact.Detect(file)
+	if err != nil {
+		return result, err
+	}
+	result.Format = format
+	if site.Signature != nil && format != artifact.FormatBundle {
+		return result, errUnsignedArtifact
+	}
+
+	inactivePartition := site.GetInactivePartition()
+	inactivePath := site.GetInactiveTargetPath()
+	stagingPath := inactivePath + ".upload"
+	if err := os.RemoveAll(stagingPath); err != nil {
+		return result, fmt.Errorf("清理临时目录失败: %w", err)
+	}
+	defer os.RemoveAll(stagingPath)
+	result.Partition = inactivePartition
+
+	log.Printf("[%s] 解包版本 %s (%s) 到: %s", site.Label(), version, format, stagingPath)
+	if format == artifact.FormatBundle {
+		err = repo.UnbundleToPath(site, file, stagingPath, site.GetActiveTargetPath())
+	} else {
+		maxSize, maxEntries := cfg.GetUploadExtractLimits()
+		err = artifact.Extract(file, format, site.GetServeRoot(stagingPath), artifact.Limits{MaxSize: maxSize, MaxEntries: maxEntries})
+	}
+	if err != nil {
+		return result, fmt.Errorf("解包版本 %s 失败: %w", version, err)
+	}
+
+	ref := ""
+	if format == artifact.FormatBundle {
+		if ref, result.Commit, err = repo.GetHeadRef(stagingPath); err != nil {
+			return result, fmt.Errorf("读取分区提交失败: %w", err)
+		}
+		if err := BuildPartition(cfg, site, stagingPath, configPath); err != nil {
+			return result, fmt.Errorf("版本 %s %w", version, err)
+		}
+	}
+	if err := verifyPartition(site, stagingPath); err != nil {
+		return result, fmt.Errorf("版本 %s %w", version, err)
+	}
+
+	if err := os.RemoveAll(inactivePath); err != nil {
+		return result, fmt.Errorf("清理非激活分区失败: %w", err)
+	}
+	if err := os.Rename(stagingPath, inactivePath); err != nil {
+		return result, fmt.Errorf("替换非激活分区失败: %w", err)
+	}
+
+	log.Println("切换活动分区")
+	site.SwitchActivePartition()
+	site.RecordUpload(site.ActivePartition, version, ref, result.Commit)
+	if err := cfg.SaveConfig(configPath); err != nil {
+		log.Printf("保存配置文件失败: %v", err)
+	}
+	ReloadStaticSite(site)
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git2Web/config"
+	"git2Web/repo"
+)
+
+// verifyPartition 在切换前检查分区中的新版本，返回所有未通过的检查
+func verifyPartition(site *config.Site, partitionPath string) error {
+	if site.Verify == nil {
+		return nil
+	}
+	v := site.Verify
+	root := site.GetServeRoot(partitionPath)
+	log.Printf("[%s] 开始检查分区: %s", site.Label(), root)
+
+	var failures []string
+	for _, name := range v.RequiredFiles {
+		file := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(name, "/")))
+		if stat, err := os.Stat(file); err != nil || stat.IsDir() {
+			failures = append(failures, "缺少文件: "+name)
+		}
+	}
+
+	if v.MinFiles > 0 {
+		count, err := countFiles(root)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("统计文件失败: %v", err))
+		} else if count < v.MinFiles {
+			failures = append(failures, fmt.Sprintf("文件数 %d 少于 %d", count, v.MinFiles))
+		}
+	}
+
+	if v.NoLfsPointers {
+		pointers, err := repo.FindLFSPointerFiles(partitionPath)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("检查 LFS 指针失败: %v", err))
+		} else if len(pointers) > 0 {
+			failures = append(failures, fmt.Sprintf("存在 %d 个未下载的 LFS 文件，如 %s", len(pointers), pointers[0]))
+		}
+	}
+
+	if len(v.Probes) > 0 {
+		failures = append(failures, runProbes(site, partitionPath)...)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("分区检查未通过:\n%s", strings.Join(failures, "\n"))
+	}
+	log.Printf("[%s] 分区检查通过", site.Label())
+	return nil
+}
+
+// countFiles 统计目录中的文件数，不包括 .git 目录
+func countFiles(root string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.Type().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// runProbes 在本机临时端口上以新版本启动静态文件服务，逐个访问检查路径
+func runProbes(site *config.Site, partitionPath string) []string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return []string{fmt.Sprintf("启动临时监听失败: %v", err)}
+	}
+	server := &http.Server{
+		Handler:     newStaticHandler(partitionPath, site),
+		ReadTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		// 保留重定向响应本身，便于检查 3xx 状态码
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	base := "http://" + listener.Addr().String()
+
+	var failures []string
+	for _, probe := range site.Verify.Probes {
+		want := probe.Status
+		if want == 0 {
+			want = http.StatusOK
+		}
+		path := "/" + strings.TrimPrefix(probe.Path, "/")
+
+		resp, err := client.Get(base + path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("访问 %s 失败: %v", path, err))
+			continue
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		resp.Body.Close()
+
+		if resp.StatusCode != want {
+			failures = append(failures, fmt.Sprintf("访问 %s 返回 %d，期望 %d", path, resp.StatusCode, want))
+			continue
+		}
+		if probe.Contains != "" && !strings.Contains(string(body), probe.Contains) {
+			failures = append(failures, fmt.Sprintf("访问 %s 的响应不包含 %q", path, probe.Contains))
+		}
+	}
+	return failures
+}
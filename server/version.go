@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"git2Web/config"
+	"git2Web/repo"
+)
+
+// siteVersion 站点当前提供服务的版本
+type siteVersion struct {
+	Site      string `json:"site"`
+	Partition string `json:"partition"`
+	Target    string `json:"target"`
+	// Version 通过上传部署时指定的版本
+	Version string `json:"version,omitempty"`
+	*repo.RepoState
+	Error string `json:"error,omitempty"`
+}
+
+// getSiteVersion 读取站点活动分区的仓库状态
+func getSiteVersion(site *config.Site) *siteVersion {
+	siteState := site.State()
+	v := &siteVersion{
+		Site:      site.Label(),
+		Partition: siteState.ActivePartition,
+		Target:    site.DescribeTargetRef(),
+		Version:   siteState.Partitions[siteState.ActivePartition].Version,
+	}
+	// 上传的构建产物没有仓库，只报告上传时指定的版本
+	state, err := repo.GetRepoState(site.GetPartitionPath(siteState.ActivePartition))
+	if err != nil && v.Version == "" {
+		v.Error = err.Error()
+	}
+	v.RepoState = state
+	return v
+}
+
+// versionHandler 版本接口，GET /version[?site=<name>]
+// 指定站点或只有一个站点时返回该站点的版本，否则在 sites 中返回所有站点的版本
+func versionHandler(config *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var result interface{}
+		name := r.URL.Query().Get("site")
+		if site := config.FindSite(name); site != nil {
+			v := getSiteVersion(site)
+			if v.Error != "" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(v)
+				return
+			}
+			result = v
+		} else if name != "" {
+			http.Error(w, "未找到站点", http.StatusNotFound)
+			return
+		} else {
+			var versions []*siteVersion
+			for _, site := range config.AllSites() {
+				versions = append(versions, getSiteVersion(site))
+			}
+			result = map[string]interface{}{"sites": versions}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}